@@ -3,6 +3,7 @@ package ast
 import (
 	"bytes"
 	"monna/token"
+	"strconv"
 	"strings"
 )
 
@@ -21,6 +22,12 @@ type Expression interface {
 	expression_node()
 }
 
+// Pattern is the shape a value is taken apart by, in the arms of a match expression.
+type Pattern interface {
+	Node
+	pattern_node()
+}
+
 func (l_program *Program) String() string {
 	var out bytes.Buffer
 	for _, s := range l_program.Statements {
@@ -36,7 +43,7 @@ type Program struct {
 // Let Statements
 type LetStatement struct {
 	Token token.Token // token.LET token
-	Name  *Identifier
+	Name  Pattern     // an *Identifier, or an array or hash pattern the value is destructured by
 	Value Expression
 }
 
@@ -63,10 +70,20 @@ func (ls *LetStatement) String() string {
 type Identifier struct {
 	Token token.Token // the token.IDENT token
 	Value string
+
+	// Filled in by the resolver. Depth is the number of function scopes between the use of the
+	// identifier and the scope that declares it, Slot is the position of the binding in that scope.
+	// Globals and builtins have a Slot of -1 and are looked up by name.
+	Resolved bool
+	Depth    int
+	Slot     int
 }
 
 func (i *Identifier) expression_node() {}
 
+// As a pattern an identifier matches any value and binds it to the name.
+func (i *Identifier) pattern_node() {}
+
 func (i *Identifier) TokenLiteral() string {
 	return i.Token.Literal
 }
@@ -106,6 +123,98 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+// Import Statements
+type ImportStatement struct {
+	Token token.Token // token.IMPORT token
+	Path  string      // as written, i.e. "lib/strings.mn"
+	Name  *Identifier // the name the module is bound to
+}
+
+func (is *ImportStatement) statement_node()      {}
+func (is *ImportStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImportStatement) String() string {
+	return is.TokenLiteral() + " " + strconv.Quote(is.Path) + " as " + is.Name.String() + ";"
+}
+
+// Export Statements
+type ExportStatement struct {
+	Token     token.Token // token.EXPORT token
+	Statement Statement   // the declaration being exported
+}
+
+func (es *ExportStatement) statement_node()      {}
+func (es *ExportStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExportStatement) String() string {
+	return es.TokenLiteral() + " " + es.Statement.String()
+}
+
+// struct Point { x, y }
+type StructStatement struct {
+	Token  token.Token // token.STRUCT token
+	Name   *Identifier
+	Fields []*Identifier
+}
+
+func (ss *StructStatement) statement_node()      {}
+func (ss *StructStatement) TokenLiteral() string { return ss.Token.Literal }
+func (ss *StructStatement) String() string {
+	if len(ss.Fields) == 0 {
+		return ss.TokenLiteral() + " " + ss.Name.String() + " {}"
+	}
+	fields := []string{}
+	for _, field := range ss.Fields {
+		fields = append(fields, field.String())
+	}
+	return ss.TokenLiteral() + " " + ss.Name.String() + " { " + strings.Join(fields, ", ") + " }"
+}
+
+// fn add(a, b) { a + b }
+type FunctionStatement struct {
+	Token    token.Token // token.FUNCTION token
+	Name     *Identifier
+	Function *FunctionLiteral
+}
+
+func (fs *FunctionStatement) statement_node()      {}
+func (fs *FunctionStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *FunctionStatement) String() string {
+	return "fn " + fs.Name.String() + strings.TrimPrefix(fs.Function.String(), "fn")
+}
+
+// enum Result { Ok(value), Err(error) }
+type EnumStatement struct {
+	Token    token.Token // token.ENUM token
+	Name     *Identifier
+	Variants []EnumVariant
+}
+
+// A variant with no fields is a value of its own, one with fields is a constructor taking them in order.
+type EnumVariant struct {
+	Name   *Identifier
+	Fields []*Identifier
+}
+
+func (es *EnumStatement) statement_node()      {}
+func (es *EnumStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *EnumStatement) String() string {
+	variants := []string{}
+	for _, variant := range es.Variants {
+		variants = append(variants, variant.String())
+	}
+	return es.TokenLiteral() + " " + es.Name.String() + " { " + strings.Join(variants, ", ") + " }"
+}
+
+func (ev EnumVariant) String() string {
+	if len(ev.Fields) == 0 {
+		return ev.Name.String()
+	}
+	fields := []string{}
+	for _, field := range ev.Fields {
+		fields = append(fields, field.String())
+	}
+	return ev.Name.String() + "(" + strings.Join(fields, ", ") + ")"
+}
+
 // Expression Statement
 type ExpressionStatement struct {
 	Token      token.Token // the first token in the expression
@@ -141,6 +250,16 @@ func (il *IntegerLiteral) String() string {
 	return il.Token.Literal
 }
 
+// FloatLiteral
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expression_node()     {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
+
 // PrefixExpression
 type PrefixExpression struct {
 	Token    token.Token // prefix token i.e. !
@@ -239,9 +358,13 @@ func (bs *BlockStatement) String() string {
 
 // Function literals
 type FunctionLiteral struct {
-	Token      token.Token // the 'fn' token
+	Token      token.Token // the 'fn' token, or the '=>' of an arrow function
 	Parameters []*Identifier
 	Body       *BlockStatement
+
+	// Filled in by the resolver, the number of local bindings (parameters and lets) in the body.
+	Resolved bool
+	Slots    int
 }
 
 func (fl *FunctionLiteral) expression_node()     {}
@@ -253,8 +376,7 @@ func (fl *FunctionLiteral) String() string {
 	for _, p := range fl.Parameters {
 		params = append(params, p.String())
 	}
-	out.WriteString(fl.TokenLiteral())
-	out.WriteString("(")
+	out.WriteString("fn(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") ")
 	out.WriteString(fl.Body.String())
@@ -267,6 +389,7 @@ type CallExpression struct {
 	Token     token.Token // The '(' token
 	Function  Expression  // Identifier or FunctionLiteral
 	Arguments []Expression
+	Tail      bool // the call is the last thing its function does, so its frame can be reused
 }
 
 func (ce *CallExpression) expression_node()     {}
@@ -296,3 +419,231 @@ type StringLiteral struct {
 func (sl *StringLiteral) expression_node()     {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
 func (sl *StringLiteral) String() string       { return sl.Token.Literal }
+
+// Array
+type ArrayLiteral struct {
+	Token    token.Token // the '[' token
+	Elements []Expression
+}
+
+func (al *ArrayLiteral) expression_node()     {}
+func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) String() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, element := range al.Elements {
+		elements = append(elements, element.String())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+	return out.String()
+}
+
+// Index Expression
+type IndexExpression struct {
+	Token token.Token // the '[' token
+	Left  Expression
+	Index Expression
+}
+
+func (ie *IndexExpression) expression_node()     {}
+func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ie.Left.String())
+	out.WriteString("[")
+	out.WriteString(ie.Index.String())
+	out.WriteString("])")
+	return out.String()
+}
+
+// Hash
+type HashLiteral struct {
+	Token token.Token // the '{' token
+	Pairs []HashLiteralPair
+}
+
+// The pairs are kept in the order they are written, so the keys and values are evaluated in that order.
+type HashLiteralPair struct {
+	Key   Expression
+	Value Expression
+}
+
+func (hl *HashLiteral) expression_node()     {}
+func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) String() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, pair.Key.String()+": "+pair.Value.String())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
+// Member Expression
+type MemberExpression struct {
+	Token    token.Token // the '.' or '?.' token
+	Object   Expression
+	Member   *Identifier // only the name, it is not looked up in any environment
+	Optional bool        // object?.member, null when the object is
+}
+
+func (me *MemberExpression) expression_node()     {}
+func (me *MemberExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MemberExpression) String() string {
+	return "(" + me.Object.String() + me.TokenLiteral() + me.Member.String() + ")"
+}
+
+// Conditional Expression, condition ? consequence : alternative
+type ConditionalExpression struct {
+	Token       token.Token // the '?' token
+	Condition   Expression
+	Consequence Expression
+	Alternative Expression
+}
+
+func (ce *ConditionalExpression) expression_node()     {}
+func (ce *ConditionalExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *ConditionalExpression) String() string {
+	return "(" + ce.Condition.String() + " ? " + ce.Consequence.String() + " : " + ce.Alternative.String() + ")"
+}
+
+// Match Expression
+type MatchExpression struct {
+	Token   token.Token // the 'match' token
+	Subject Expression
+	Arms    []MatchArm
+}
+
+// The arms are tried in order, the first whose pattern matches and whose Guard, if any, is truthy gives the
+// value of the match. Each arm is a scope of its own, holding what its pattern binds.
+type MatchArm struct {
+	Pattern Pattern
+	Guard   Expression
+	Body    Expression
+
+	// Filled in by the resolver, the number of bindings in the arm, those of the pattern and lets in the body.
+	Resolved bool
+	Slots    int
+}
+
+func (me *MatchExpression) expression_node()     {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MatchExpression) String() string {
+	var out bytes.Buffer
+
+	arms := []string{}
+	for _, arm := range me.Arms {
+		guard := ""
+		if arm.Guard != nil {
+			guard = " if " + arm.Guard.String()
+		}
+		arms = append(arms, arm.Pattern.String()+guard+" => "+arm.Body.String())
+	}
+
+	out.WriteString("match (")
+	out.WriteString(me.Subject.String())
+	out.WriteString(") { ")
+	out.WriteString(strings.Join(arms, ", "))
+	out.WriteString(" }")
+	return out.String()
+}
+
+// Literal Pattern, matches a value equal to an integer, float, string or boolean literal.
+type LiteralPattern struct {
+	Token token.Token // the first token of the literal
+	Value Expression
+}
+
+func (lp *LiteralPattern) pattern_node()        {}
+func (lp *LiteralPattern) TokenLiteral() string { return lp.Token.Literal }
+func (lp *LiteralPattern) String() string       { return lp.Value.String() }
+
+// Wildcard Pattern, `_` matches any value without binding it.
+type WildcardPattern struct {
+	Token token.Token // the '_' token
+}
+
+func (wp *WildcardPattern) pattern_node()        {}
+func (wp *WildcardPattern) TokenLiteral() string { return wp.Token.Literal }
+func (wp *WildcardPattern) String() string       { return "_" }
+
+// Array Pattern, `[first, second, ...rest]`. Without a rest it only matches arrays of exactly as many
+// elements, with one it matches arrays of at least as many and Rest is matched against the remainder.
+type ArrayPattern struct {
+	Token    token.Token // the '[' token
+	Elements []Pattern
+	Rest     Pattern // nil without `...`
+}
+
+func (ap *ArrayPattern) pattern_node()        {}
+func (ap *ArrayPattern) TokenLiteral() string { return ap.Token.Literal }
+func (ap *ArrayPattern) String() string {
+	elements := []string{}
+	for _, element := range ap.Elements {
+		elements = append(elements, element.String())
+	}
+	if ap.Rest != nil {
+		elements = append(elements, "..."+ap.Rest.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// Hash Pattern, `{name, "age": age}`. It matches hashes that have every key, whatever other keys they
+// have. A key without a pattern binds the value to the name of the key.
+type HashPattern struct {
+	Token token.Token // the '{' token
+	Pairs []HashPatternPair
+}
+
+type HashPatternPair struct {
+	Key   string
+	Value Pattern
+}
+
+// Variant Pattern, `Ok(value)`, `Result.Err(_)` or `Status.Pending`. With an enum it matches values of
+// that very variant of the enum, without one values of any variant with that name. Without parentheses
+// the payload isn't looked at, with them there is a pattern for each of its values.
+type VariantPattern struct {
+	Token   token.Token // the first token of the pattern
+	Enum    *Identifier // nil when the pattern only names the variant
+	Variant string
+	Values  []Pattern // nil without parentheses
+}
+
+func (vp *VariantPattern) pattern_node()        {}
+func (vp *VariantPattern) TokenLiteral() string { return vp.Token.Literal }
+func (vp *VariantPattern) String() string {
+	name := vp.Variant
+	if vp.Enum != nil {
+		name = vp.Enum.Value + "." + vp.Variant
+	}
+	if vp.Values == nil {
+		return name
+	}
+	values := []string{}
+	for _, value := range vp.Values {
+		values = append(values, value.String())
+	}
+	return name + "(" + strings.Join(values, ", ") + ")"
+}
+
+func (hp *HashPattern) pattern_node()        {}
+func (hp *HashPattern) TokenLiteral() string { return hp.Token.Literal }
+func (hp *HashPattern) String() string {
+	pairs := []string{}
+	for _, pair := range hp.Pairs {
+		pairs = append(pairs, strconv.Quote(pair.Key)+": "+pair.Value.String())
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
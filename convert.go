@@ -0,0 +1,449 @@
+package monna
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"monna/evaluator"
+	"monna/object"
+	"reflect"
+)
+
+var (
+	object_type    = reflect.TypeOf((*object.Object)(nil)).Elem()
+	error_type     = reflect.TypeOf((*error)(nil)).Elem()
+	context_type   = reflect.TypeOf((*context.Context)(nil)).Elem()
+	interface_type = reflect.TypeOf((*interface{})(nil)).Elem()
+)
+
+// Go -> Monna
+func (l_interpreter *Interpreter) to_object(value interface{}) (object.Object, error) {
+	if value == nil {
+		return evaluator.NULL, nil
+	}
+	if obj, ok := value.(object.Object); ok {
+		return obj, nil
+	}
+	return l_interpreter.reflect_to_object(reflect.ValueOf(value))
+}
+
+func (l_interpreter *Interpreter) reflect_to_object(value reflect.Value) (object.Object, error) {
+	if value.IsValid() && value.Type().Implements(object_type) && value.CanInterface() {
+		if (value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface) && value.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return value.Interface().(object.Object), nil
+	}
+
+	switch value.Kind() {
+	case reflect.Invalid:
+		return evaluator.NULL, nil
+
+	case reflect.Bool:
+		if value.Bool() {
+			return evaluator.TRUE, nil
+		}
+		return evaluator.FALSE, nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: value.Int()}, nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if value.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("%d overflows INTEGER", value.Uint())
+		}
+		return &object.Integer{Value: int64(value.Uint())}, nil
+
+	case reflect.Float32, reflect.Float64:
+		return &object.Float{Value: value.Float()}, nil
+
+	case reflect.String:
+		return &object.String{Value: value.String()}, nil
+
+	case reflect.Interface, reflect.Ptr:
+		if value.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return l_interpreter.reflect_to_object(value.Elem())
+
+	case reflect.Slice, reflect.Array:
+		elements := make([]object.Object, value.Len())
+		for i := range elements {
+			element, err := l_interpreter.reflect_to_object(value.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = element
+		}
+		return &object.Array{Elements: elements}, nil
+
+	case reflect.Map:
+		hash := object.NewHash()
+		iter := value.MapRange()
+		for iter.Next() {
+			key, err := l_interpreter.reflect_to_object(iter.Key())
+			if err != nil {
+				return nil, err
+			}
+			hashable, ok := key.(object.Hashable)
+			if !ok {
+				return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+			}
+			element, err := l_interpreter.reflect_to_object(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			hash.Pairs[hashable.HashKey()] = object.HashPair{Key: key, Value: element}
+		}
+		return hash, nil
+
+	case reflect.Func:
+		return l_interpreter.wrap_function("", value)
+	}
+
+	return nil, fmt.Errorf("cannot convert %s to a monna value", value.Type())
+}
+
+// Turns a Go function into a builtin, converting the arguments it is called with to its parameter types.
+// A function whose first parameter is a context.Context gets the context of the evaluation there.
+func (l_interpreter *Interpreter) wrap_function(name string, fn reflect.Value) (*object.Builtin, error) {
+	fn_type := fn.Type()
+	if name == "" {
+		name = fn_type.String()
+	}
+
+	first := 0
+	if fn_type.NumIn() > 0 && fn_type.In(0) == context_type {
+		first = 1
+	}
+
+	params := []object.ObjectType{}
+	for i := first; i < fn_type.NumIn(); i++ {
+		param_type := fn_type.In(i)
+		if fn_type.IsVariadic() && i == fn_type.NumIn()-1 {
+			param_type = param_type.Elem()
+		}
+		params = append(params, parameter_type(param_type))
+	}
+
+	returns_error := fn_type.NumOut() > 0 && fn_type.Out(fn_type.NumOut()-1) == error_type
+	results := fn_type.NumOut()
+	if returns_error {
+		results -= 1
+	}
+	if results > 1 {
+		return nil, fmt.Errorf("cannot convert %s to a monna value, it returns more than one value", fn_type)
+	}
+
+	builtin := func(call *object.CallContext, args ...object.Object) object.Object {
+		in := []reflect.Value{}
+		if first == 1 {
+			ctx := call.Context
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			in = append(in, reflect.ValueOf(&ctx).Elem())
+		}
+
+		for i, arg := range args {
+			index := first + i
+			var param_type reflect.Type
+			if fn_type.IsVariadic() && index >= fn_type.NumIn()-1 {
+				param_type = fn_type.In(fn_type.NumIn() - 1).Elem()
+			} else {
+				param_type = fn_type.In(index)
+			}
+
+			value, err := l_interpreter.from_object_to(arg, param_type)
+			if err != nil {
+				return &object.Error{Kind: object.RUNTIME_ERROR, Message: fmt.Sprintf("argument %d: %s", i+1, err)}
+			}
+			in = append(in, value)
+		}
+
+		out := fn.Call(in)
+		if returns_error {
+			if err, _ := out[len(out)-1].Interface().(error); err != nil {
+				return &object.Error{Kind: object.RUNTIME_ERROR, Message: err.Error()}
+			}
+		}
+		if results == 0 {
+			return evaluator.NULL
+		}
+
+		result, err := l_interpreter.reflect_to_object(out[0])
+		if err != nil {
+			return &object.Error{Kind: object.RUNTIME_ERROR, Message: err.Error()}
+		}
+		return result
+	}
+
+	return &object.Builtin{Name: name, Params: params, Variadic: fn_type.IsVariadic(), Fn: builtin}, nil
+}
+
+// The monna type a builtin declares for a Go parameter, the evaluator checks it before the call.
+func parameter_type(param reflect.Type) object.ObjectType {
+	if param.Implements(object_type) {
+		return object.ANY_OBJECT
+	}
+
+	switch param.Kind() {
+	case reflect.Bool:
+		return object.BOOLEAN_OBJECT
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return object.INTEGER_OBJECT
+	case reflect.Float32, reflect.Float64:
+		return object.NUMBER_OBJECT
+	case reflect.String:
+		return object.STRING_OBJECT
+	case reflect.Slice, reflect.Array:
+		return object.ARRAY_OBJECT
+	case reflect.Map:
+		return object.HASH_OBJECT
+	}
+	return object.ANY_OBJECT
+}
+
+// Monna -> Go
+//
+// Without a target type, INTEGER becomes int64, FLOAT float64, ARRAY []interface{}, HASH map[interface{}]interface{},
+// STRUCT map[string]interface{} keyed by field name and functions func(...interface{}) (interface{}, error). An
+// ENUM_VALUE stays the *object.EnumValue it is, a map would lose which variant it is.
+func (l_interpreter *Interpreter) from_object(obj object.Object) (interface{}, error) {
+	value, err := l_interpreter.from_object_to(obj, interface_type)
+	if err != nil {
+		return nil, err
+	}
+	if !value.IsValid() || (value.Kind() == reflect.Interface && value.IsNil()) {
+		return nil, nil
+	}
+	return value.Interface(), nil
+}
+
+// Converts obj into target, which must be a pointer.
+func (l_interpreter *Interpreter) convert(obj object.Object, target interface{}) error {
+	pointer := reflect.ValueOf(target)
+	value, err := l_interpreter.from_object_to(obj, pointer.Type().Elem())
+	if err != nil {
+		return err
+	}
+	pointer.Elem().Set(value)
+	return nil
+}
+
+func (l_interpreter *Interpreter) from_object_to(obj object.Object, target reflect.Type) (reflect.Value, error) {
+	if reflect.TypeOf(obj).AssignableTo(target) && target != interface_type {
+		return reflect.ValueOf(obj), nil
+	}
+
+	mismatch := func() (reflect.Value, error) {
+		return reflect.Value{}, fmt.Errorf("cannot convert %s to %s", obj.Type(), target)
+	}
+
+	if obj.Type() == object.NULL_OBJECT {
+		switch target.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Slice, reflect.Map, reflect.Func:
+			return reflect.Zero(target), nil
+		}
+		return mismatch()
+	}
+
+	switch target.Kind() {
+	case reflect.Interface:
+		if target.NumMethod() != 0 {
+			return mismatch()
+		}
+		natural, err := l_interpreter.natural_type(obj)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		value, err := l_interpreter.from_object_to(obj, natural)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		result := reflect.New(target).Elem()
+		result.Set(value)
+		return result, nil
+
+	case reflect.Bool:
+		boolean, ok := obj.(*object.Boolean)
+		if !ok {
+			return mismatch()
+		}
+		return reflect.ValueOf(boolean.Value).Convert(target), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		integer, ok := obj.(*object.Integer)
+		if !ok {
+			return mismatch()
+		}
+		value := reflect.New(target).Elem()
+		if value.OverflowInt(integer.Value) {
+			return reflect.Value{}, fmt.Errorf("%d overflows %s", integer.Value, target)
+		}
+		value.SetInt(integer.Value)
+		return value, nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		integer, ok := obj.(*object.Integer)
+		if !ok {
+			return mismatch()
+		}
+		value := reflect.New(target).Elem()
+		if integer.Value < 0 || value.OverflowUint(uint64(integer.Value)) {
+			return reflect.Value{}, fmt.Errorf("%d overflows %s", integer.Value, target)
+		}
+		value.SetUint(uint64(integer.Value))
+		return value, nil
+
+	case reflect.Float32, reflect.Float64:
+		value := reflect.New(target).Elem()
+		switch number := obj.(type) {
+		case *object.Float:
+			value.SetFloat(number.Value)
+		case *object.Integer:
+			value.SetFloat(float64(number.Value))
+		default:
+			return mismatch()
+		}
+		return value, nil
+
+	case reflect.String:
+		str, ok := obj.(*object.String)
+		if !ok {
+			return mismatch()
+		}
+		return reflect.ValueOf(str.Value).Convert(target), nil
+
+	case reflect.Slice:
+		array, ok := obj.(*object.Array)
+		if !ok {
+			return mismatch()
+		}
+		slice := reflect.MakeSlice(target, len(array.Elements), len(array.Elements))
+		for i, element := range array.Elements {
+			value, err := l_interpreter.from_object_to(element, target.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			slice.Index(i).Set(value)
+		}
+		return slice, nil
+
+	case reflect.Map:
+		if instance, ok := obj.(*object.StructInstance); ok {
+			if target.Key().Kind() != reflect.String {
+				return mismatch()
+			}
+			result := reflect.MakeMapWithSize(target, len(instance.Values))
+			for i, field := range instance.Struct.Fields {
+				value, err := l_interpreter.from_object_to(instance.Values[i], target.Elem())
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				result.SetMapIndex(reflect.ValueOf(field).Convert(target.Key()), value)
+			}
+			return result, nil
+		}
+		hash, ok := obj.(*object.Hash)
+		if !ok {
+			return mismatch()
+		}
+		result := reflect.MakeMapWithSize(target, len(hash.Pairs))
+		for _, pair := range hash.Pairs {
+			key, err := l_interpreter.from_object_to(pair.Key, target.Key())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			value, err := l_interpreter.from_object_to(pair.Value, target.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			result.SetMapIndex(key, value)
+		}
+		return result, nil
+
+	case reflect.Func:
+		if obj.Type() != object.FUNCTION_OBJECT && obj.Type() != object.BUILTIN_OBJ {
+			return mismatch()
+		}
+		return l_interpreter.make_function(obj, target)
+	}
+
+	return mismatch()
+}
+
+func (l_interpreter *Interpreter) natural_type(obj object.Object) (reflect.Type, error) {
+	switch obj.(type) {
+	case *object.Integer:
+		return reflect.TypeOf(int64(0)), nil
+	case *object.Float:
+		return reflect.TypeOf(float64(0)), nil
+	case *object.String:
+		return reflect.TypeOf(""), nil
+	case *object.Boolean:
+		return reflect.TypeOf(false), nil
+	case *object.Array:
+		return reflect.TypeOf([]interface{}{}), nil
+	case *object.Hash:
+		return reflect.TypeOf(map[interface{}]interface{}{}), nil
+	case *object.StructInstance:
+		return reflect.TypeOf(map[string]interface{}{}), nil
+	case *object.EnumValue:
+		return reflect.TypeOf(obj), nil
+	case *object.Function, *object.Builtin:
+		return reflect.TypeOf(func(...interface{}) (interface{}, error) { return nil, nil }), nil
+	}
+	return nil, fmt.Errorf("cannot convert %s to a Go value", obj.Type())
+}
+
+// Builds a Go function of the target type that calls fn. If the function type has no error result, a
+// monna error panics with an *Error.
+func (l_interpreter *Interpreter) make_function(fn object.Object, target reflect.Type) (reflect.Value, error) {
+	returns_error := target.NumOut() > 0 && target.Out(target.NumOut()-1) == error_type
+	results := target.NumOut()
+	if returns_error {
+		results -= 1
+	}
+	if results > 1 {
+		return reflect.Value{}, fmt.Errorf("cannot convert %s to %s, it returns more than one value", fn.Type(), target)
+	}
+
+	function := func(in []reflect.Value) []reflect.Value {
+		args := []interface{}{}
+		for i, value := range in {
+			if target.IsVariadic() && i == len(in)-1 {
+				for j := 0; j < value.Len(); j++ {
+					args = append(args, value.Index(j).Interface())
+				}
+				continue
+			}
+			args = append(args, value.Interface())
+		}
+
+		out := make([]reflect.Value, target.NumOut())
+		for i := range out {
+			out[i] = reflect.Zero(target.Out(i))
+		}
+
+		result, err := l_interpreter.apply(context.Background(), fn, args)
+		if err == nil && results == 1 {
+			var value reflect.Value
+			value, err = l_interpreter.from_object_to(result, target.Out(0))
+			if err == nil {
+				out[0] = value
+			}
+		}
+
+		if err != nil {
+			if !returns_error {
+				panic(err)
+			}
+			out[len(out)-1] = reflect.ValueOf(&err).Elem()
+		}
+		return out
+	}
+
+	return reflect.MakeFunc(target, function), nil
+}
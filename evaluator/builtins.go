@@ -1,31 +1,107 @@
 package evaluator
 
-import(
+import (
 	"fmt"
+	"io"
 	"monna/object"
+	"strings"
 )
 
-var builtins = map[string]*object.Builtin{
-	"len": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return new_error("wrong number of arguments, got=%d, want=1", len(args))
-			}
-
+// The builtins every new Registry starts out with.
+var builtins = []*object.Builtin{
+	{
+		Name:   "len",
+		Params: []object.ObjectType{object.ANY_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
 			switch arg := args[0].(type) {
 			case *object.String:
 				return &object.Integer{Value: int64(len(arg.Value))}
+			case *object.Array:
+				return &object.Integer{Value: int64(len(arg.Elements))}
+			case *object.Hash:
+				return &object.Integer{Value: int64(len(arg.Pairs))}
 			default:
 				return new_error("argument to `len` not supported, got %s", args[0].Type())
 			}
 		},
 	},
-	"puts": &object.Builtin {
-		Fn: func(args ...object.Object) object.Object {
+	{
+		Name:     "puts",
+		Params:   []object.ObjectType{object.ANY_OBJECT},
+		Variadic: true,
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
 			for _, arg := range args {
-				fmt.Println(arg.Inspect())
+				fmt.Fprintln(call.Stdout, arg.Inspect())
 			}
 			return NULL // puts only print things passed into it, it does not return a value when used in a function or such.
 		},
 	},
+	{
+		Name:     "print",
+		Params:   []object.ObjectType{object.ANY_OBJECT},
+		Variadic: true,
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			for _, arg := range args {
+				io.WriteString(call.Stdout, arg.Inspect())
+			}
+			return NULL // same as puts, without a newline after every argument
+		},
+	},
+	{
+		Name:     "eprint",
+		Params:   []object.ObjectType{object.ANY_OBJECT},
+		Variadic: true,
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			for _, arg := range args {
+				fmt.Fprintln(call.Stderr, arg.Inspect())
+			}
+			return NULL // same as puts, to STDERR
+		},
+	},
+	{
+		// try(body, handler) calls body and gives back its value. If body fails, handler is called instead
+		// with a hash holding the "kind" and the "message" of the error. Running into an execution limit or
+		// being cancelled can't be caught.
+		Name:   "try",
+		Params: []object.ObjectType{object.ANY_OBJECT, object.ANY_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			result := call.Apply(args[0])
+			err, ok := result.(*object.Error)
+			if !ok || !err.Catchable() {
+				return result
+			}
+
+			details := object.NewHash()
+			for _, pair := range [][2]string{{"kind", string(err.Kind)}, {"message", err.Message}} {
+				key := &object.String{Value: pair[0]}
+				details.Pairs[key.HashKey()] = object.HashPair{Key: key, Value: &object.String{Value: pair[1]}}
+			}
+			return call.Apply(args[1], details)
+		},
+	},
+	{
+		Name: "read_line",
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			line, err := call.Stdin.ReadString('\n')
+			if err != nil && err != io.EOF {
+				return new_error("read_line: %s", err)
+			}
+			if err == io.EOF && line == "" {
+				return NULL // nothing left to read
+			}
+			line = strings.TrimSuffix(line, "\n")
+			line = strings.TrimSuffix(line, "\r")
+			return &object.String{Value: line}
+		},
+	},
+	{
+		Name: "read_all",
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			all, err := io.ReadAll(call.Stdin)
+			if err != nil {
+				return new_error("read_all: %s", err)
+			}
+			return &object.String{Value: string(all)}
+		},
+	},
 }
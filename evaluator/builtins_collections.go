@@ -0,0 +1,265 @@
+package evaluator
+
+import (
+	"math"
+	"monna/object"
+	"sort"
+)
+
+// Collection builtins, in the "collections" namespace. The ones taking a callback call it through
+// CallContext.Apply, so it can be a monna function or a builtin, and stop at the first error it returns.
+// None of them change the array they are given.
+var collection_builtins = []*object.Builtin{
+	{
+		Name:      "map",
+		Namespace: "collections",
+		Params:    []object.ObjectType{object.ARRAY_OBJECT, object.ANY_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			elements := args[0].(*object.Array).Elements
+			mapped := make([]object.Object, len(elements))
+			for i, element := range elements {
+				result := call.Apply(args[1], element)
+				if is_error(result) {
+					return result
+				}
+				mapped[i] = result
+			}
+			return &object.Array{Elements: mapped}
+		},
+	},
+	{
+		Name:      "filter",
+		Namespace: "collections",
+		Params:    []object.ObjectType{object.ARRAY_OBJECT, object.ANY_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			filtered := []object.Object{}
+			for _, element := range args[0].(*object.Array).Elements {
+				result := call.Apply(args[1], element)
+				if is_error(result) {
+					return result
+				}
+				if is_truthy(result) {
+					filtered = append(filtered, element)
+				}
+			}
+			return &object.Array{Elements: filtered}
+		},
+	},
+	{
+		// reduce(array, fn(accumulator, element), initial), without an initial value the first element is
+		// used and the callback starts at the second one.
+		Name:      "reduce",
+		Namespace: "collections",
+		Params:    []object.ObjectType{object.ARRAY_OBJECT, object.ANY_OBJECT, object.ANY_OBJECT},
+		Optional:  1,
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			elements := args[0].(*object.Array).Elements
+			var accumulator object.Object
+			if len(args) == 3 {
+				accumulator = args[2]
+			} else if len(elements) > 0 {
+				accumulator, elements = elements[0], elements[1:]
+			} else {
+				return new_error("reduce of empty array with no initial value")
+			}
+
+			for _, element := range elements {
+				accumulator = call.Apply(args[1], accumulator, element)
+				if is_error(accumulator) {
+					return accumulator
+				}
+			}
+			return accumulator
+		},
+	},
+	{
+		Name:      "each",
+		Namespace: "collections",
+		Params:    []object.ObjectType{object.ARRAY_OBJECT, object.ANY_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			for _, element := range args[0].(*object.Array).Elements {
+				if result := call.Apply(args[1], element); is_error(result) {
+					return result
+				}
+			}
+			return NULL
+		},
+	},
+	{
+		// sort(array, fn(a, b)) orders the array with a comparator returning true when a goes before b.
+		// Without one, arrays of numbers or of strings are sorted in ascending order. The sort is stable.
+		Name:      "sort",
+		Namespace: "collections",
+		Params:    []object.ObjectType{object.ARRAY_OBJECT, object.ANY_OBJECT},
+		Optional:  1,
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			sorted := append([]object.Object{}, args[0].(*object.Array).Elements...)
+
+			if len(args) == 1 {
+				for _, element := range sorted {
+					if !(is_number(element) && is_number(sorted[0])) && !(element.Type() == object.STRING_OBJECT && sorted[0].Type() == object.STRING_OBJECT) {
+						return new_error("sort without a comparator needs an array of numbers or of strings, got %s", element.Type())
+					}
+				}
+				sort.SliceStable(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+				return &object.Array{Elements: sorted}
+			}
+
+			var err object.Object
+			sort.SliceStable(sorted, func(i, j int) bool {
+				if err != nil {
+					return false
+				}
+				result := call.Apply(args[1], sorted[i], sorted[j])
+				if is_error(result) {
+					err = result
+					return false
+				}
+				before, ok := result.(*object.Boolean)
+				if !ok {
+					err = new_error("sort comparator must return BOOLEAN, got %s", result.Type())
+					return false
+				}
+				return before.Value
+			})
+			if err != nil {
+				return err
+			}
+			return &object.Array{Elements: sorted}
+		},
+	},
+	{
+		// zip pairs up the elements of two arrays, it is as long as the shorter one.
+		Name:      "zip",
+		Namespace: "collections",
+		Params:    []object.ObjectType{object.ARRAY_OBJECT, object.ARRAY_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			left := args[0].(*object.Array).Elements
+			right := args[1].(*object.Array).Elements
+			length := len(left)
+			if len(right) < length {
+				length = len(right)
+			}
+
+			pairs := make([]object.Object, length)
+			for i := 0; i < length; i++ {
+				pairs[i] = &object.Array{Elements: []object.Object{left[i], right[i]}}
+			}
+			return &object.Array{Elements: pairs}
+		},
+	},
+	{
+		// range(end), range(start, end) and range(start, end, step) count from start up to, but not
+		// including, end. A negative step counts down.
+		Name:      "range",
+		Namespace: "collections",
+		Params:    []object.ObjectType{object.INTEGER_OBJECT, object.INTEGER_OBJECT, object.INTEGER_OBJECT},
+		Optional:  2,
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			start, end, step := int64(0), args[0].(*object.Integer).Value, int64(1)
+			if len(args) > 1 {
+				start, end = end, args[1].(*object.Integer).Value
+			}
+			if len(args) > 2 {
+				step = args[2].(*object.Integer).Value
+			}
+			if step == 0 {
+				return new_error("range step must not be zero")
+			}
+
+			count := range_length(start, end, step)
+			if count > math.MaxInt32 {
+				return new_error("range is too large: %d elements", count)
+			}
+			if err := call.Allocate(int64(count)); err != nil {
+				return err
+			}
+
+			numbers := make([]object.Object, 0, count)
+			for i := uint64(0); i < count; i++ {
+				if i%CONTEXT_CHECK_INTERVAL == 0 && call.Context.Err() != nil {
+					return new_limit_error(object.CANCELLED_ERROR, "evaluation cancelled: %s", call.Context.Err())
+				}
+				numbers = append(numbers, &object.Integer{Value: start + int64(i)*step})
+			}
+			return &object.Array{Elements: numbers}
+		},
+	},
+	{
+		// find gives the first element the callback is truthy for, or null.
+		Name:      "find",
+		Namespace: "collections",
+		Params:    []object.ObjectType{object.ARRAY_OBJECT, object.ANY_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			for _, element := range args[0].(*object.Array).Elements {
+				result := call.Apply(args[1], element)
+				if is_error(result) {
+					return result
+				}
+				if is_truthy(result) {
+					return element
+				}
+			}
+			return NULL
+		},
+	},
+	{
+		Name:      "any",
+		Namespace: "collections",
+		Params:    []object.ObjectType{object.ARRAY_OBJECT, object.ANY_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			for _, element := range args[0].(*object.Array).Elements {
+				result := call.Apply(args[1], element)
+				if is_error(result) {
+					return result
+				}
+				if is_truthy(result) {
+					return TRUE
+				}
+			}
+			return FALSE
+		},
+	},
+	{
+		Name:      "all",
+		Namespace: "collections",
+		Params:    []object.ObjectType{object.ARRAY_OBJECT, object.ANY_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			for _, element := range args[0].(*object.Array).Elements {
+				result := call.Apply(args[1], element)
+				if is_error(result) {
+					return result
+				}
+				if !is_truthy(result) {
+					return FALSE
+				}
+			}
+			return TRUE
+		},
+	},
+}
+
+// Natural order of two numbers or two strings.
+func less(left, right object.Object) bool {
+	if left, ok := left.(*object.Integer); ok {
+		if right, ok := right.(*object.Integer); ok {
+			return left.Value < right.Value
+		}
+	}
+	if is_number(left) {
+		return to_float(left) < to_float(right)
+	}
+	return left.(*object.String).Value < right.(*object.String).Value
+}
+
+// How many numbers range(start, end, step) counts, worked out in uint64 so the distance between the ends
+// can't overflow.
+func range_length(start, end, step int64) uint64 {
+	if (step > 0 && start >= end) || (step < 0 && start <= end) {
+		return 0
+	}
+	if step > 0 {
+		return (uint64(end)-uint64(start)-1)/uint64(step) + 1
+	}
+	return (uint64(start)-uint64(end)-1)/(uint64(-step)) + 1
+}
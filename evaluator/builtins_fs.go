@@ -0,0 +1,194 @@
+package evaluator
+
+import (
+	"errors"
+	"io/fs"
+	"monna/object"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Filesystem builtins, in the "fs" namespace. Every path goes through allowed_path first, so scripts only
+// reach the files the host gave them in CallContext.Files. Going anywhere else is a PERMISSION error.
+var fs_builtins = []*object.Builtin{
+	{
+		Name:      "read_file",
+		Namespace: "fs",
+		Params:    []object.ObjectType{object.STRING_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			path, err := allowed_path(call.Files, args[0].(*object.String).Value, false)
+			if err != nil {
+				return err
+			}
+			contents, read_err := os.ReadFile(path)
+			if read_err != nil {
+				return new_error("read_file: %s", read_err)
+			}
+			return &object.String{Value: string(contents)}
+		},
+	},
+	{
+		// write_file(path, contents) creates the file, or replaces what was in it.
+		Name:      "write_file",
+		Namespace: "fs",
+		Params:    []object.ObjectType{object.STRING_OBJECT, object.STRING_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			path, err := allowed_path(call.Files, args[0].(*object.String).Value, true)
+			if err != nil {
+				return err
+			}
+			if write_err := os.WriteFile(path, []byte(args[1].(*object.String).Value), 0644); write_err != nil {
+				return new_error("write_file: %s", write_err)
+			}
+			return NULL
+		},
+	},
+	{
+		// list_dir gives the names of the entries of a directory in alphabetical order.
+		Name:      "list_dir",
+		Namespace: "fs",
+		Params:    []object.ObjectType{object.STRING_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			path, err := allowed_path(call.Files, args[0].(*object.String).Value, false)
+			if err != nil {
+				return err
+			}
+			entries, read_err := os.ReadDir(path)
+			if read_err != nil {
+				return new_error("list_dir: %s", read_err)
+			}
+
+			names := make([]string, len(entries))
+			for i, entry := range entries {
+				names[i] = entry.Name()
+			}
+			sort.Strings(names)
+
+			elements := make([]object.Object, len(names))
+			for i, name := range names {
+				elements[i] = &object.String{Value: name}
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	{
+		Name:      "exists",
+		Namespace: "fs",
+		Params:    []object.ObjectType{object.STRING_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			path, err := allowed_path(call.Files, args[0].(*object.String).Value, false)
+			if err != nil {
+				return err
+			}
+			_, stat_err := os.Stat(path)
+			if stat_err != nil && !errors.Is(stat_err, fs.ErrNotExist) {
+				return new_error("exists: %s", stat_err)
+			}
+			return native_bool_to_boolean_object(stat_err == nil)
+		},
+	},
+	{
+		// remove deletes a file or an empty directory.
+		Name:      "remove",
+		Namespace: "fs",
+		Params:    []object.ObjectType{object.STRING_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			path, err := allowed_path(call.Files, args[0].(*object.String).Value, true)
+			if err != nil {
+				return err
+			}
+			if is_root(call.Files, path) {
+				return new_permission_error("access denied: %s is an allowed directory itself", args[0].Inspect())
+			}
+			if remove_err := os.Remove(path); remove_err != nil {
+				return new_error("remove: %s", remove_err)
+			}
+			return NULL
+		},
+	},
+}
+
+// Turns the path a script gave into the absolute path it may use, or a PERMISSION error. Symbolic links are
+// followed before the path is checked, so a link inside a root can't lead outside of it.
+func allowed_path(access object.FileAccess, path string, write bool) (string, *object.Error) {
+	if len(access.Roots) == 0 {
+		return "", new_permission_error("access denied: %s, scripts have no filesystem access", path)
+	}
+	if write && access.ReadOnly {
+		return "", new_permission_error("access denied: %s, scripts have read-only filesystem access", path)
+	}
+
+	absolute := path
+	if !filepath.IsAbs(path) {
+		absolute = filepath.Join(access.Roots[0], path)
+	}
+	resolved, err := resolve_path(absolute)
+	if err != nil {
+		return "", new_error("%s", err)
+	}
+
+	for _, root := range access.Roots {
+		root, err := resolve_path(root)
+		if err != nil {
+			continue
+		}
+		prefix := root
+		if !strings.HasSuffix(prefix, string(filepath.Separator)) {
+			prefix += string(filepath.Separator)
+		}
+		if resolved == root || strings.HasPrefix(resolved, prefix) {
+			return resolved, nil
+		}
+	}
+	return "", new_permission_error("access denied: %s is outside the allowed directories", path)
+}
+
+// Makes path absolute and follows the symbolic links in it. The part of the path that doesn't exist yet,
+// i.e. a file about to be written, is kept as it is. A link to something that doesn't exist yet is still
+// followed, writing to it would create its target, so that is the path that has to be allowed.
+func resolve_path(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	resolved, err := filepath.EvalSymlinks(path)
+	if err == nil {
+		return resolved, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	if info, err := os.Lstat(path); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(path), target)
+		}
+		return resolve_path(target)
+	}
+
+	parent := filepath.Dir(path)
+	if parent == path {
+		return path, nil
+	}
+	resolved_parent, err := resolve_path(parent)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(resolved_parent, filepath.Base(path)), nil
+}
+
+func is_root(access object.FileAccess, path string) bool {
+	for _, root := range access.Roots {
+		if root, err := resolve_path(root); err == nil && root == path {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,193 @@
+package evaluator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"monna/object"
+	"strconv"
+	"strings"
+)
+
+// JSON builtins, in the "json" namespace.
+var json_builtins = []*object.Builtin{
+	{
+		// json_encode(value, indent) gives back value as JSON, indented by that many spaces, at most
+		// MAX_JSON_INDENT, when indent is given. Hash keys must be strings, they come out in sorted order.
+		Name:      "json_encode",
+		Namespace: "json",
+		Params:    []object.ObjectType{object.ANY_OBJECT, object.INTEGER_OBJECT},
+		Optional:  1,
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			value, err := to_json(args[0], "$", map[object.Object]bool{})
+			if err != nil {
+				return new_error("json_encode: %s", err)
+			}
+
+			var out bytes.Buffer
+			encoder := json.NewEncoder(&out)
+			encoder.SetEscapeHTML(false)
+			if len(args) == 2 {
+				spaces := args[1].(*object.Integer).Value
+				if spaces < 0 || spaces > MAX_JSON_INDENT {
+					return new_error("argument 2 to `json_encode` must be between 0 and %d, got %d", MAX_JSON_INDENT, spaces)
+				}
+				encoder.SetIndent("", strings.Repeat(" ", int(spaces)))
+			}
+			if err := encoder.Encode(value); err != nil {
+				return new_error("json_encode: %s", err)
+			}
+			if err := call.Allocate(int64(out.Len())); err != nil {
+				return err
+			}
+			return &object.String{Value: strings.TrimSuffix(out.String(), "\n")}
+		},
+	},
+	{
+		// json_decode gives back the value in a JSON document. Objects become hashes with string keys,
+		// whole numbers that fit become integers and every other number a float.
+		Name:      "json_decode",
+		Namespace: "json",
+		Params:    []object.ObjectType{object.STRING_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			input := args[0].(*object.String).Value
+			decoder := json.NewDecoder(strings.NewReader(input))
+			decoder.UseNumber()
+
+			var value interface{}
+			if err := decoder.Decode(&value); err != nil {
+				return json_syntax_error(err, len(input))
+			}
+			if _, err := decoder.Token(); err != io.EOF {
+				return new_error("json_decode: unexpected data after the value at offset %d", decoder.InputOffset())
+			}
+			return from_json(value)
+		},
+	},
+}
+
+// The most spaces json_encode indents by, every line repeats the indent once per level so a large one
+// makes the output grow far beyond the value.
+const MAX_JSON_INDENT = 16
+
+// Converts a monna value to what encoding/json encodes, path says where in the value it is so an error can
+// point at the part that can't be encoded. seen holds the arrays and hashes being converted, to catch one
+// that contains itself.
+func to_json(obj object.Object, path string, seen map[object.Object]bool) (interface{}, error) {
+	switch obj := obj.(type) {
+	case *object.Null:
+		return nil, nil
+	case *object.Boolean:
+		return obj.Value, nil
+	case *object.Integer:
+		return obj.Value, nil
+	case *object.Float:
+		if math.IsNaN(obj.Value) || math.IsInf(obj.Value, 0) {
+			return nil, fmt.Errorf("cannot encode %s at %s", obj.Inspect(), path)
+		}
+		return obj.Value, nil
+	case *object.String:
+		return obj.Value, nil
+
+	case *object.Array:
+		if seen[obj] {
+			return nil, fmt.Errorf("cannot encode an array that contains itself at %s", path)
+		}
+		seen[obj] = true
+		defer delete(seen, obj)
+
+		elements := make([]interface{}, len(obj.Elements))
+		for i, element := range obj.Elements {
+			value, err := to_json(element, fmt.Sprintf("%s[%d]", path, i), seen)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = value
+		}
+		return elements, nil
+
+	case *object.Hash:
+		if seen[obj] {
+			return nil, fmt.Errorf("cannot encode a hash that contains itself at %s", path)
+		}
+		seen[obj] = true
+		defer delete(seen, obj)
+
+		members := make(map[string]interface{}, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			key, ok := pair.Key.(*object.String)
+			if !ok {
+				return nil, fmt.Errorf("hash key must be STRING, got %s at %s", pair.Key.Type(), path)
+			}
+			value, err := to_json(pair.Value, path+"."+key.Value, seen)
+			if err != nil {
+				return nil, err
+			}
+			members[key.Value] = value
+		}
+		return members, nil
+	}
+
+	return nil, fmt.Errorf("cannot encode %s at %s", obj.Type(), path)
+}
+
+// Converts what encoding/json decoded, with UseNumber, to a monna value.
+func from_json(value interface{}) object.Object {
+	switch value := value.(type) {
+	case nil:
+		return NULL
+	case bool:
+		return native_bool_to_boolean_object(value)
+	case string:
+		return &object.String{Value: value}
+
+	case json.Number:
+		if integer, err := strconv.ParseInt(string(value), 10, 64); err == nil {
+			return &object.Integer{Value: integer}
+		}
+		float, err := strconv.ParseFloat(string(value), 64)
+		if err != nil {
+			return new_error("json_decode: number out of range: %s", value)
+		}
+		return &object.Float{Value: float}
+
+	case []interface{}:
+		elements := make([]object.Object, len(value))
+		for i, element := range value {
+			elements[i] = from_json(element)
+			if is_error(elements[i]) {
+				return elements[i]
+			}
+		}
+		return &object.Array{Elements: elements}
+
+	case map[string]interface{}:
+		hash := object.NewHash()
+		for key, member := range value {
+			element := from_json(member)
+			if is_error(element) {
+				return element
+			}
+			key := &object.String{Value: key}
+			hash.Pairs[key.HashKey()] = object.HashPair{Key: key, Value: element}
+		}
+		return hash
+	}
+
+	return new_error("json_decode: unexpected value %v", value)
+}
+
+// Describes malformed JSON with the offset, in bytes, where decoding went wrong.
+func json_syntax_error(err error, length int) object.Object {
+	var syntax *json.SyntaxError
+	if errors.As(err, &syntax) {
+		return new_error("json_decode: %s at offset %d", syntax, syntax.Offset)
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return new_error("json_decode: unexpected end of input at offset %d", length)
+	}
+	return new_error("json_decode: %s", err)
+}
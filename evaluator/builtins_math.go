@@ -0,0 +1,208 @@
+package evaluator
+
+import (
+	"math"
+	"math/rand"
+	"monna/object"
+)
+
+// Constants in the "math" namespace.
+var math_constants = map[string]object.Object{
+	"pi": &object.Float{Value: math.Pi},
+	"e":  &object.Float{Value: math.E},
+}
+
+// Math builtins, in the "math" namespace. They take integers and floats alike, and keep integers as
+// integers where the result is exact.
+var math_builtins = []*object.Builtin{
+	{
+		Name:      "abs",
+		Namespace: "math",
+		Params:    []object.ObjectType{object.NUMBER_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			if integer, ok := args[0].(*object.Integer); ok {
+				if integer.Value < 0 {
+					return &object.Integer{Value: -integer.Value}
+				}
+				return integer
+			}
+			return &object.Float{Value: math.Abs(to_float(args[0]))}
+		},
+	},
+	{
+		Name:      "min",
+		Namespace: "math",
+		Params:    []object.ObjectType{object.NUMBER_OBJECT, object.NUMBER_OBJECT},
+		Variadic:  true,
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			smallest := args[0]
+			for _, arg := range args[1:] {
+				if to_float(arg) < to_float(smallest) {
+					smallest = arg
+				}
+			}
+			return smallest
+		},
+	},
+	{
+		Name:      "max",
+		Namespace: "math",
+		Params:    []object.ObjectType{object.NUMBER_OBJECT, object.NUMBER_OBJECT},
+		Variadic:  true,
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			largest := args[0]
+			for _, arg := range args[1:] {
+				if to_float(arg) > to_float(largest) {
+					largest = arg
+				}
+			}
+			return largest
+		},
+	},
+	{
+		// pow of two integers is an integer, unless the exponent is negative.
+		Name:      "pow",
+		Namespace: "math",
+		Params:    []object.ObjectType{object.NUMBER_OBJECT, object.NUMBER_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			base, base_is_integer := args[0].(*object.Integer)
+			exponent, exponent_is_integer := args[1].(*object.Integer)
+			if !base_is_integer || !exponent_is_integer || exponent.Value < 0 {
+				return &object.Float{Value: math.Pow(to_float(args[0]), to_float(args[1]))}
+			}
+			return &object.Integer{Value: integer_power(base.Value, exponent.Value)}
+		},
+	},
+	{
+		Name:      "sqrt",
+		Namespace: "math",
+		Params:    []object.ObjectType{object.NUMBER_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			if to_float(args[0]) < 0 {
+				return new_error("sqrt of negative number: %s", args[0].Inspect())
+			}
+			return &object.Float{Value: math.Sqrt(to_float(args[0]))}
+		},
+	},
+	{
+		Name:      "floor",
+		Namespace: "math",
+		Params:    []object.ObjectType{object.NUMBER_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			return float_to_integer("floor", args[0], math.Floor)
+		},
+	},
+	{
+		Name:      "ceil",
+		Namespace: "math",
+		Params:    []object.ObjectType{object.NUMBER_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			return float_to_integer("ceil", args[0], math.Ceil)
+		},
+	},
+	{
+		// round rounds half away from zero, round(2.5) is 3 and round(-2.5) is -3.
+		Name:      "round",
+		Namespace: "math",
+		Params:    []object.ObjectType{object.NUMBER_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			return float_to_integer("round", args[0], math.Round)
+		},
+	},
+	float_function("sin", math.Sin),
+	float_function("cos", math.Cos),
+	float_function("tan", math.Tan),
+	float_function("asin", math.Asin),
+	float_function("acos", math.Acos),
+	float_function("atan", math.Atan),
+	{
+		Name:      "atan2",
+		Namespace: "math",
+		Params:    []object.ObjectType{object.NUMBER_OBJECT, object.NUMBER_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			return &object.Float{Value: math.Atan2(to_float(args[0]), to_float(args[1]))}
+		},
+	},
+	{
+		// random() is a float in [0, 1), random(n) an integer in [0, n) and random(low, high) an integer
+		// in [low, high).
+		Name:      "random",
+		Namespace: "math",
+		Params:    []object.ObjectType{object.INTEGER_OBJECT, object.INTEGER_OBJECT},
+		Optional:  2,
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			if len(args) == 0 {
+				return &object.Float{Value: call.Random.Float64()}
+			}
+
+			low, high := int64(0), args[0].(*object.Integer).Value
+			if len(args) == 2 {
+				low, high = high, args[1].(*object.Integer).Value
+			}
+			if high <= low {
+				return new_error("random range is empty: [%d, %d)", low, high)
+			}
+			return &object.Integer{Value: low + int64(random_below(call.Random, uint64(high)-uint64(low)))}
+		},
+	},
+	{
+		// seed makes the numbers random gives from now on the same on every run.
+		Name:      "seed",
+		Namespace: "math",
+		Params:    []object.ObjectType{object.INTEGER_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			call.Random.Seed(args[0].(*object.Integer).Value)
+			return NULL
+		},
+	},
+}
+
+// A random number in [0, n). The span between two integers can be more than the largest int64, those
+// spans are drawn from all of uint64 until the number falls inside, which it does at least half the time.
+func random_below(random *rand.Rand, n uint64) uint64 {
+	if n <= math.MaxInt64 {
+		return uint64(random.Int63n(int64(n)))
+	}
+	for {
+		if number := random.Uint64(); number < n {
+			return number
+		}
+	}
+}
+
+// A builtin taking one number and giving back the float fn makes of it.
+func float_function(name string, fn func(float64) float64) *object.Builtin {
+	return &object.Builtin{
+		Name:      name,
+		Namespace: "math",
+		Params:    []object.ObjectType{object.NUMBER_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			return &object.Float{Value: fn(to_float(args[0]))}
+		},
+	}
+}
+
+// Applies fn to a float and gives back the result as an integer, integers are already whole.
+func float_to_integer(name string, number object.Object, fn func(float64) float64) object.Object {
+	if integer, ok := number.(*object.Integer); ok {
+		return integer
+	}
+	value := fn(number.(*object.Float).Value)
+	if math.IsNaN(value) || value < math.MinInt64 || value >= math.MaxInt64 {
+		return new_error("cannot %s %s to an integer", name, number.Inspect())
+	}
+	return &object.Integer{Value: int64(value)}
+}
+
+// base to the power of a non-negative exponent, by squaring. Like every integer operation it wraps around
+// on overflow.
+func integer_power(base, exponent int64) int64 {
+	result := int64(1)
+	for ; exponent > 0; exponent >>= 1 {
+		if exponent&1 == 1 {
+			result *= base
+		}
+		base *= base
+	}
+	return result
+}
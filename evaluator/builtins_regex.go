@@ -0,0 +1,189 @@
+package evaluator
+
+import (
+	"monna/object"
+	"regexp"
+	"sync"
+)
+
+// Regular expression builtins, in the "regex" namespace. Patterns use the syntax of Go's regexp package.
+// Everywhere a regex is expected a pattern string works too, it is compiled once and then taken from the
+// cache.
+var regex_builtins = []*object.Builtin{
+	{
+		Name:      "regex",
+		Namespace: "regex",
+		Params:    []object.ObjectType{object.STRING_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			compiled, err := compile_regex(args[0].(*object.String).Value)
+			if err != nil {
+				return err
+			}
+			return &object.Regex{Value: compiled}
+		},
+	},
+	{
+		// match gives the first match as an array, the whole match followed by every capture group, or null
+		// when there is none. A group that took no part in the match is null.
+		Name:      "match",
+		Namespace: "regex",
+		Params:    []object.ObjectType{object.ANY_OBJECT, object.STRING_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			compiled, err := regex_argument("match", args[0])
+			if err != nil {
+				return err
+			}
+			input := args[1].(*object.String).Value
+			indexes := compiled.FindStringSubmatchIndex(input)
+			if indexes == nil {
+				return NULL
+			}
+			return submatches(input, indexes)
+		},
+	},
+	{
+		// captures gives the named groups of the first match as a hash, i.e. captures("(?P<year>\\d+)", s)
+		// has the key "year". It is null when there is no match.
+		Name:      "captures",
+		Namespace: "regex",
+		Params:    []object.ObjectType{object.ANY_OBJECT, object.STRING_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			compiled, err := regex_argument("captures", args[0])
+			if err != nil {
+				return err
+			}
+			input := args[1].(*object.String).Value
+			indexes := compiled.FindStringSubmatchIndex(input)
+			if indexes == nil {
+				return NULL
+			}
+
+			groups := submatches(input, indexes).Elements
+			hash := object.NewHash()
+			for i, name := range compiled.SubexpNames() {
+				if name == "" {
+					continue
+				}
+				key := &object.String{Value: name}
+				hash.Pairs[key.HashKey()] = object.HashPair{Key: key, Value: groups[i]}
+			}
+			return hash
+		},
+	},
+	{
+		// find_all gives every match, without the capture groups.
+		Name:      "find_all",
+		Namespace: "regex",
+		Params:    []object.ObjectType{object.ANY_OBJECT, object.STRING_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			compiled, err := regex_argument("find_all", args[0])
+			if err != nil {
+				return err
+			}
+			matches := compiled.FindAllString(args[1].(*object.String).Value, -1)
+			elements := make([]object.Object, len(matches))
+			for i, match := range matches {
+				elements[i] = &object.String{Value: match}
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	{
+		// replace_all(regex, s, replacement) replaces every match. A replacement string can refer to capture
+		// groups as $1 or ${name}, a replacement function is called with the same array match gives and
+		// must return a string.
+		Name:      "replace_all",
+		Namespace: "regex",
+		Params:    []object.ObjectType{object.ANY_OBJECT, object.STRING_OBJECT, object.ANY_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			compiled, err := regex_argument("replace_all", args[0])
+			if err != nil {
+				return err
+			}
+			input := args[1].(*object.String).Value
+
+			switch replacement := args[2].(type) {
+			case *object.String:
+				return &object.String{Value: compiled.ReplaceAllString(input, replacement.Value)}
+			case *object.Function, *object.Builtin:
+				return replace_with_function(call, compiled, input, replacement)
+			default:
+				return new_error("argument 3 to `replace_all` must be STRING or FUNCTION, got %s", replacement.Type())
+			}
+		},
+	},
+}
+
+// How many compiled patterns are kept, the cache is emptied when it is full.
+const REGEX_CACHE_SIZE = 256
+
+var regex_cache = struct {
+	sync.Mutex
+	compiled map[string]*regexp.Regexp
+}{compiled: make(map[string]*regexp.Regexp)}
+
+func compile_regex(pattern string) (*regexp.Regexp, *object.Error) {
+	regex_cache.Lock()
+	defer regex_cache.Unlock()
+
+	if compiled, ok := regex_cache.compiled[pattern]; ok {
+		return compiled, nil
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, new_error("invalid regex: %s", err)
+	}
+
+	if len(regex_cache.compiled) >= REGEX_CACHE_SIZE {
+		regex_cache.compiled = make(map[string]*regexp.Regexp)
+	}
+	regex_cache.compiled[pattern] = compiled
+	return compiled, nil
+}
+
+// A regex argument can be a REGEX or a pattern STRING.
+func regex_argument(name string, arg object.Object) (*regexp.Regexp, *object.Error) {
+	switch arg := arg.(type) {
+	case *object.Regex:
+		return arg.Value, nil
+	case *object.String:
+		return compile_regex(arg.Value)
+	default:
+		return nil, new_error("argument 1 to `%s` must be REGEX or STRING, got %s", name, arg.Type())
+	}
+}
+
+// Turns the index pairs of a match into an array of the whole match and its groups.
+func submatches(input string, indexes []int) *object.Array {
+	elements := make([]object.Object, len(indexes)/2)
+	for i := range elements {
+		start, end := indexes[2*i], indexes[2*i+1]
+		if start < 0 {
+			elements[i] = NULL
+			continue
+		}
+		elements[i] = &object.String{Value: input[start:end]}
+	}
+	return &object.Array{Elements: elements}
+}
+
+func replace_with_function(call *object.CallContext, compiled *regexp.Regexp, input string, fn object.Object) object.Object {
+	var result []byte
+	last := 0
+	for _, indexes := range compiled.FindAllStringSubmatchIndex(input, -1) {
+		replacement := call.Apply(fn, submatches(input, indexes))
+		if is_error(replacement) {
+			return replacement
+		}
+		str, ok := replacement.(*object.String)
+		if !ok {
+			return new_error("replace_all function must return STRING, got %s", replacement.Type())
+		}
+
+		result = append(result, input[last:indexes[0]]...)
+		result = append(result, str.Value...)
+		last = indexes[1]
+	}
+	result = append(result, input[last:]...)
+	return &object.String{Value: string(result)}
+}
@@ -0,0 +1,190 @@
+package evaluator
+
+import (
+	"fmt"
+	"math"
+	"monna/object"
+	"strings"
+)
+
+// String builtins, in the "strings" namespace. Positions and lengths are in bytes, the same as `len`.
+var string_builtins = []*object.Builtin{
+	{
+		Name:      "split",
+		Namespace: "strings",
+		Params:    []object.ObjectType{object.STRING_OBJECT, object.STRING_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			parts := strings.Split(args[0].(*object.String).Value, args[1].(*object.String).Value)
+			elements := make([]object.Object, len(parts))
+			for i, part := range parts {
+				elements[i] = &object.String{Value: part}
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	{
+		Name:      "join",
+		Namespace: "strings",
+		Params:    []object.ObjectType{object.ARRAY_OBJECT, object.STRING_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			elements := args[0].(*object.Array).Elements
+			parts := make([]string, len(elements))
+			for i, element := range elements {
+				parts[i] = element.Inspect()
+			}
+			return &object.String{Value: strings.Join(parts, args[1].(*object.String).Value)}
+		},
+	},
+	{
+		Name:      "trim",
+		Namespace: "strings",
+		Params:    []object.ObjectType{object.STRING_OBJECT, object.STRING_OBJECT},
+		Optional:  1,
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			value := args[0].(*object.String).Value
+			if len(args) == 2 {
+				return &object.String{Value: strings.Trim(value, args[1].(*object.String).Value)}
+			}
+			return &object.String{Value: strings.TrimSpace(value)}
+		},
+	},
+	{
+		Name:      "upper",
+		Namespace: "strings",
+		Params:    []object.ObjectType{object.STRING_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			return &object.String{Value: strings.ToUpper(args[0].(*object.String).Value)}
+		},
+	},
+	{
+		Name:      "lower",
+		Namespace: "strings",
+		Params:    []object.ObjectType{object.STRING_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			return &object.String{Value: strings.ToLower(args[0].(*object.String).Value)}
+		},
+	},
+	{
+		Name:      "replace",
+		Namespace: "strings",
+		Params:    []object.ObjectType{object.STRING_OBJECT, object.STRING_OBJECT, object.STRING_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			value := args[0].(*object.String).Value
+			old := args[1].(*object.String).Value
+			replacement := args[2].(*object.String).Value
+			return &object.String{Value: strings.ReplaceAll(value, old, replacement)}
+		},
+	},
+	{
+		Name:      "contains",
+		Namespace: "strings",
+		Params:    []object.ObjectType{object.STRING_OBJECT, object.STRING_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			return native_bool_to_boolean_object(strings.Contains(args[0].(*object.String).Value, args[1].(*object.String).Value))
+		},
+	},
+	{
+		Name:      "starts_with",
+		Namespace: "strings",
+		Params:    []object.ObjectType{object.STRING_OBJECT, object.STRING_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			return native_bool_to_boolean_object(strings.HasPrefix(args[0].(*object.String).Value, args[1].(*object.String).Value))
+		},
+	},
+	{
+		Name:      "ends_with",
+		Namespace: "strings",
+		Params:    []object.ObjectType{object.STRING_OBJECT, object.STRING_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			return native_bool_to_boolean_object(strings.HasSuffix(args[0].(*object.String).Value, args[1].(*object.String).Value))
+		},
+	},
+	{
+		Name:      "index_of",
+		Namespace: "strings",
+		Params:    []object.ObjectType{object.STRING_OBJECT, object.STRING_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			return &object.Integer{Value: int64(strings.Index(args[0].(*object.String).Value, args[1].(*object.String).Value))}
+		},
+	},
+	{
+		// substr(s, start, end) is s[start:end], a negative index counts from the end of the string and
+		// both are clamped to the string, so substr never fails on a valid string.
+		Name:      "substr",
+		Namespace: "strings",
+		Params:    []object.ObjectType{object.STRING_OBJECT, object.INTEGER_OBJECT, object.INTEGER_OBJECT},
+		Optional:  1,
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			value := args[0].(*object.String).Value
+			start := clamp_index(args[1].(*object.Integer).Value, len(value))
+			end := len(value)
+			if len(args) == 3 {
+				end = clamp_index(args[2].(*object.Integer).Value, len(value))
+			}
+			if start >= end {
+				return &object.String{Value: ""}
+			}
+			return &object.String{Value: value[start:end]}
+		},
+	},
+	{
+		Name:      "repeat",
+		Namespace: "strings",
+		Params:    []object.ObjectType{object.STRING_OBJECT, object.INTEGER_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			count := args[1].(*object.Integer).Value
+			if count < 0 {
+				return new_error("argument 2 to `repeat` must not be negative, got %d", count)
+			}
+			value := args[0].(*object.String).Value
+			if count > 0 && int64(len(value)) > math.MaxInt32/count {
+				return new_error("repeat result is too large: %d bytes times %d", len(value), count)
+			}
+			// The result is counted a byte at a time, a long string costs as much as that many small objects.
+			if err := call.Allocate(int64(len(value)) * count); err != nil {
+				return err
+			}
+			return &object.String{Value: strings.Repeat(value, int(count))}
+		},
+	},
+	{
+		// format takes the verbs of Go's fmt package, numbers, strings and booleans are passed through as
+		// themselves and anything else as its Inspect, i.e. format("%05d|%-4s|%.2f", 42, "ab", 3.14159).
+		Name:      "format",
+		Namespace: "strings",
+		Params:    []object.ObjectType{object.STRING_OBJECT, object.ANY_OBJECT},
+		Variadic:  true,
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			values := make([]interface{}, len(args)-1)
+			for i, arg := range args[1:] {
+				switch arg := arg.(type) {
+				case *object.Integer:
+					values[i] = arg.Value
+				case *object.Float:
+					values[i] = arg.Value
+				case *object.String:
+					values[i] = arg.Value
+				case *object.Boolean:
+					values[i] = arg.Value
+				default:
+					values[i] = arg.Inspect()
+				}
+			}
+			return &object.String{Value: fmt.Sprintf(args[0].(*object.String).Value, values...)}
+		},
+	},
+}
+
+// Turns a possibly negative index into a position between 0 and length.
+func clamp_index(index int64, length int) int {
+	if index < 0 {
+		index += int64(length)
+	}
+	if index < 0 {
+		return 0
+	}
+	if index > int64(length) {
+		return length
+	}
+	return int(index)
+}
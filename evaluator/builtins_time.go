@@ -0,0 +1,148 @@
+package evaluator
+
+import (
+	"context"
+	"monna/object"
+	"time"
+)
+
+/*
+   Time
+
+   The builtins of the "time" namespace. A point in time is an integer of milliseconds since the Unix epoch
+   and a duration is an integer of milliseconds too, so times and durations are added and subtracted with
+   the usual operators:
+
+   ```
+   let deadline = now() + duration("1h30m");
+   format_duration(deadline - now());
+   ```
+
+   Layouts are those of Go's time package, i.e. "2006-01-02 15:04", and default to RFC 3339. The time
+   comes from the Clock of the evaluator, which the host can replace.
+*/
+var time_builtins = []*object.Builtin{
+	{
+		Name:      "now",
+		Namespace: "time",
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			return &object.Integer{Value: call.Clock.Now().UnixMilli()}
+		},
+	},
+	{
+		// unix gives the time in whole seconds since the Unix epoch.
+		Name:      "unix",
+		Namespace: "time",
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			return &object.Integer{Value: call.Clock.Now().Unix()}
+		},
+	},
+	{
+		// sleep(ms) returns early with a CANCELLED error when the evaluation is cancelled.
+		Name:      "sleep",
+		Namespace: "time",
+		Params:    []object.ObjectType{object.INTEGER_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			milliseconds := args[0].(*object.Integer).Value
+			if milliseconds < 0 {
+				return new_error("argument 1 to `sleep` must not be negative, got %d", milliseconds)
+			}
+			if err := call.Clock.Sleep(call.Context, time.Duration(milliseconds)*time.Millisecond); err != nil {
+				return new_limit_error(object.CANCELLED_ERROR, "evaluation cancelled: %s", err)
+			}
+			return NULL
+		},
+	},
+	{
+		// format_time(ms, layout, zone) shows a time in the layout, in UTC unless a zone such as "Local" or
+		// "Europe/Berlin" is given.
+		Name:      "format_time",
+		Namespace: "time",
+		Params:    []object.ObjectType{object.INTEGER_OBJECT, object.STRING_OBJECT, object.STRING_OBJECT},
+		Optional:  2,
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			layout, location, err := layout_and_location(args[1:])
+			if err != nil {
+				return err
+			}
+			moment := time.UnixMilli(args[0].(*object.Integer).Value).In(location)
+			return &object.String{Value: moment.Format(layout)}
+		},
+	},
+	{
+		// parse_time(s, layout, zone) reads a time written in the layout, a time without a zone in it is
+		// taken to be in UTC, or in zone when it is given.
+		Name:      "parse_time",
+		Namespace: "time",
+		Params:    []object.ObjectType{object.STRING_OBJECT, object.STRING_OBJECT, object.STRING_OBJECT},
+		Optional:  2,
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			layout, location, err := layout_and_location(args[1:])
+			if err != nil {
+				return err
+			}
+			moment, parse_err := time.ParseInLocation(layout, args[0].(*object.String).Value, location)
+			if parse_err != nil {
+				return new_error("parse_time: %s", parse_err)
+			}
+			return &object.Integer{Value: moment.UnixMilli()}
+		},
+	},
+	{
+		// duration("1h30m") is the number of milliseconds in a duration written like Go writes them.
+		Name:      "duration",
+		Namespace: "time",
+		Params:    []object.ObjectType{object.STRING_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			parsed, err := time.ParseDuration(args[0].(*object.String).Value)
+			if err != nil {
+				return new_error("duration: %s", err)
+			}
+			return &object.Integer{Value: parsed.Milliseconds()}
+		},
+	},
+	{
+		Name:      "format_duration",
+		Namespace: "time",
+		Params:    []object.ObjectType{object.INTEGER_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			milliseconds := time.Duration(args[0].(*object.Integer).Value) * time.Millisecond
+			return &object.String{Value: milliseconds.String()}
+		},
+	},
+}
+
+// The optional layout and zone arguments of format_time and parse_time.
+func layout_and_location(args []object.Object) (string, *time.Location, *object.Error) {
+	layout, location := time.RFC3339, time.UTC
+	if len(args) > 0 {
+		layout = args[0].(*object.String).Value
+	}
+	if len(args) > 1 {
+		loaded, err := time.LoadLocation(args[1].(*object.String).Value)
+		if err != nil {
+			return "", nil, new_error("unknown time zone: %s", args[1].(*object.String).Value)
+		}
+		location = loaded
+	}
+	return layout, location, nil
+}
+
+// SystemClock is the real time, the clock of a new Evaluator.
+type SystemClock struct{}
+
+func (l_clock SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (l_clock SystemClock) Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -1,9 +1,17 @@
 package evaluator
 
 import (
+	"bufio"
+	"context"
 	"fmt"
+	"io"
+	"math"
+	"math/rand"
 	"monna/ast"
 	"monna/object"
+	"monna/token"
+	"os"
+	"time"
 )
 
 var (
@@ -12,92 +20,402 @@ var (
 	FALSE = &object.Boolean{Value: false}
 )
 
+/*
+   Execution Limits
+
+   Monna is embedded to run scripts written by someone else, and a script that recurses forever should
+   not take the host down with it. An evaluation can be bounded in four ways:
+
+   - MaxSteps:       the number of AST nodes evaluated.
+   - MaxDepth:       the number of nested function calls. Tail calls reuse their caller's frame and are
+                     not counted, see apply_function.
+   - MaxAllocations: the number of objects and call frames created.
+   - a context.Context, checked every few steps, for timeouts and cancellation from the host.
+
+   When a limit is hit the evaluation stops with an *object.Error whose Kind tells which one it was.
+*/
+
+// Options bound a single evaluation, zero means no limit.
+type Options struct {
+	MaxSteps       int64
+	MaxDepth       int
+	MaxAllocations int64
+}
+
+// How many steps go by between checks of the context, checking it costs a lock.
+const CONTEXT_CHECK_INTERVAL = 256
+
+// Evaluator holds the state of one evaluation. It is not safe for concurrent use.
+type Evaluator struct {
+	Builtins *Registry
+
+	// The standard streams of scripts, os.Stdout, os.Stderr and os.Stdin unless the host says otherwise.
+	Stdout       io.Writer
+	Stderr       io.Writer
+	Stdin        io.Reader
+	stdin        *bufio.Reader // buffers Stdin so read_line doesn't lose what it read ahead between calls
+	stdin_source io.Reader
+
+	// Random is what math.random() draws from, seeded from the clock by New. Seeding it, or calling
+	// math.seed() from a script, makes every run give the same numbers.
+	Random *rand.Rand
+
+	// Files is where scripts may read and write files, nowhere unless the host says otherwise.
+	Files object.FileAccess
+
+	// Clock is the time scripts see, the SystemClock unless the host says otherwise.
+	Clock object.Clock
+
+	// Modules loads what scripts import, from no search paths unless the host says otherwise.
+	Modules *Loader
+
+	ctx     context.Context
+	options Options
+
+	steps       int64
+	depth       int
+	allocations int64
+	halted      *object.Error // set once a limit is hit so every later step fails too
+	running     bool
+}
+
+func New() *Evaluator {
+	return &Evaluator{
+		Builtins: NewRegistry(),
+		Stdout:   os.Stdout,
+		Stderr:   os.Stderr,
+		Stdin:    os.Stdin,
+		Random:   rand.New(rand.NewSource(time.Now().UnixNano())),
+		Clock:    SystemClock{},
+		Modules:  NewLoader(),
+		ctx:      context.Background(),
+	}
+}
+
+// Eval evaluates a node without any limits.
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	return New().Eval(node, env)
+}
+
+// EvalContext evaluates a node until it is done, a limit in options is exceeded or ctx is cancelled.
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment, options Options) object.Object {
+	return New().EvalContext(ctx, node, env, options)
+}
+
+func (l_evaluator *Evaluator) Eval(node ast.Node, env *object.Environment) object.Object {
+	return l_evaluator.EvalContext(context.Background(), node, env, Options{})
+}
+
+func (l_evaluator *Evaluator) EvalContext(ctx context.Context, node ast.Node, env *object.Environment, options Options) object.Object {
+	if l_evaluator.running {
+		return l_evaluator.eval(node, env)
+	}
+	l_evaluator.start(ctx, options)
+	defer l_evaluator.stop()
+
+	return l_evaluator.eval(node, env)
+}
+
+// ApplyContext calls a monna function or builtin with the given arguments, under the same limits as
+// EvalContext. It is how the host calls back into a script.
+func (l_evaluator *Evaluator) ApplyContext(ctx context.Context, fn object.Object, args []object.Object, options Options) object.Object {
+	if l_evaluator.running {
+		return l_evaluator.apply_function(fn, args, nil, token.Position{})
+	}
+	l_evaluator.start(ctx, options)
+	defer l_evaluator.stop()
+
+	return l_evaluator.apply_function(fn, args, nil, token.Position{})
+}
+
+// A host function called from a script may call back into the evaluator, that nested evaluation keeps
+// counting against the limits of the one already running instead of starting over.
+func (l_evaluator *Evaluator) start(ctx context.Context, options Options) {
+	l_evaluator.running = true
+	l_evaluator.ctx = ctx
+	l_evaluator.options = options
+	l_evaluator.steps = 0
+	l_evaluator.depth = 0
+	l_evaluator.allocations = 0
+	l_evaluator.halted = nil
+}
+
+func (l_evaluator *Evaluator) stop() {
+	l_evaluator.running = false
+}
+
+func (l_evaluator *Evaluator) step() *object.Error {
+	if l_evaluator.halted != nil {
+		return l_evaluator.halted
+	}
+	l_evaluator.steps += 1
+
+	options := l_evaluator.options
+	switch {
+	case options.MaxSteps > 0 && l_evaluator.steps > options.MaxSteps:
+		l_evaluator.halted = new_limit_error(object.STEP_LIMIT_ERROR, "step limit exceeded: %d", options.MaxSteps)
+
+	case options.MaxAllocations > 0 && l_evaluator.allocations > options.MaxAllocations:
+		l_evaluator.halted = new_limit_error(object.ALLOCATION_LIMIT_ERROR, "allocation limit exceeded: %d", options.MaxAllocations)
+
+	case l_evaluator.steps%CONTEXT_CHECK_INTERVAL == 0 && l_evaluator.ctx.Err() != nil:
+		l_evaluator.halted = new_limit_error(object.CANCELLED_ERROR, "evaluation cancelled: %s", l_evaluator.ctx.Err())
+	}
+	return l_evaluator.halted
+}
+
+// Counts an object created on behalf of the program against Options.MaxAllocations.
+func (l_evaluator *Evaluator) allocate() {
+	l_evaluator.allocations += 1
+}
+
+// Counts many objects at once, for builtins that build large values. Unlike allocate it checks the limit
+// straight away, so a builtin can refuse before it runs out of memory.
+func (l_evaluator *Evaluator) allocate_many(count int64) *object.Error {
+	if l_evaluator.halted != nil {
+		return l_evaluator.halted
+	}
+	max_allocations := l_evaluator.options.MaxAllocations
+	if max_allocations > 0 && count > max_allocations-l_evaluator.allocations {
+		l_evaluator.halted = new_limit_error(object.ALLOCATION_LIMIT_ERROR, "allocation limit exceeded: %d", max_allocations)
+		return l_evaluator.halted
+	}
+	if count > math.MaxInt64-l_evaluator.allocations {
+		l_evaluator.allocations = math.MaxInt64
+	} else {
+		l_evaluator.allocations += count
+	}
+	return nil
+}
+
+func (l_evaluator *Evaluator) eval(node ast.Node, env *object.Environment) object.Object {
+	if err := l_evaluator.step(); err != nil {
+		return err
+	}
+
 	switch node := node.(type) {
 	// Statements
 	case *ast.Program:
-		return eval_program(node, env)
+		return l_evaluator.eval_program(node, env)
 
 	case *ast.BlockStatement:
-		return eval_block_statement(node, env)
+		return l_evaluator.eval_block_statement(node, env)
 
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return l_evaluator.eval(node.Expression, env)
 
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
+		val := l_evaluator.eval(node.ReturnValue, env)
 		if is_error(val) {
 			return val
 		}
+		l_evaluator.allocate()
 		return &object.ReturnValue{Value: val}
 
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
+		val := l_evaluator.eval(node.Value, env)
 		if is_error(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		if err := l_evaluator.destructure(node.Name, val, env); err != nil {
+			return err
+		}
+
+	case *ast.ImportStatement:
+		module := l_evaluator.import_module(node.Path)
+		if is_error(module) {
+			return module
+		}
+		bind(node.Name, module, env)
+
+	case *ast.ExportStatement:
+		return l_evaluator.eval(node.Statement, env)
+
+	case *ast.StructStatement:
+		fields := make([]string, len(node.Fields))
+		for i, field := range node.Fields {
+			fields[i] = field.Value
+		}
+		l_evaluator.allocate()
+		bind(node.Name, &object.StructType{Name: node.Name.Value, Fields: fields}, env)
+
+	case *ast.EnumStatement:
+		enum := &object.EnumType{Name: node.Name.Value}
+		for _, declared := range node.Variants {
+			variant := &object.Variant{Enum: enum, Name: declared.Name.Value}
+			for _, field := range declared.Fields {
+				variant.Fields = append(variant.Fields, field.Value)
+			}
+			enum.Variants = append(enum.Variants, variant)
+		}
+		l_evaluator.allocate()
+		bind(node.Name, enum, env)
+
+	case *ast.FunctionStatement:
+		function := l_evaluator.eval(node.Function, env)
+		if is_error(function) {
+			return function
+		}
+		bind(node.Name, function, env)
 
 		// Expressions
 	case *ast.IntegerLiteral:
+		l_evaluator.allocate()
 		return &object.Integer{Value: node.Value}
 
+	case *ast.FloatLiteral:
+		l_evaluator.allocate()
+		return &object.Float{Value: node.Value}
+
 	case *ast.Boolean:
 		return native_bool_to_boolean_object(node.Value)
 
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
+		right := l_evaluator.eval(node.Right, env)
 		if is_error(right) {
 			return right
 		}
-		return eval_prefix_expression(node.Operator, right)
+		return l_evaluator.eval_prefix_expression(node.Operator, right)
 
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
+		if node.Operator == "&&" || node.Operator == "||" {
+			return l_evaluator.eval_logical_expression(node, env)
+		}
+		if node.Operator == "??" {
+			return l_evaluator.eval_nullish_expression(node, env)
+		}
+		left := l_evaluator.eval(node.Left, env)
 		if is_error(left) {
 			return left
 		}
 
-		right := Eval(node.Right, env)
+		right := l_evaluator.eval(node.Right, env)
 		if is_error(right) {
 			return right
 		}
-		return eval_infix_expression(node.Operator, left, right)
+		return l_evaluator.eval_infix_expression(node.Operator, left, right)
 
 	case *ast.IfExpression:
-		return eval_if_expression(node, env)
+		return l_evaluator.eval_if_expression(node, env)
+
+	case *ast.ConditionalExpression:
+		condition := l_evaluator.eval(node.Condition, env)
+		if is_error(condition) {
+			return condition
+		}
+		if is_truthy(condition) {
+			return l_evaluator.eval(node.Consequence, env)
+		}
+		return l_evaluator.eval(node.Alternative, env)
 
 	case *ast.Identifier:
-		return eval_identifier(node, env)
+		return l_evaluator.eval_identifier(node, env)
 
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		slots := -1
+		if node.Resolved {
+			slots = node.Slots
+		}
+		l_evaluator.allocate()
+		return &object.Function{Parameters: params, Env: env, Body: body, Slots: slots}
 
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
-		if is_error(function) {
-			return function
-		}
-		args := eval_expression(node.Arguments, env)
-		if len(args) == 1 && is_error(args[0]) {
-			return args[0]
-		}
-		return apply_function(function, args)
+		result, _ := l_evaluator.eval_chain(node, env)
+		return result
 
 	case *ast.StringLiteral:
+		l_evaluator.allocate()
 		return &object.String{Value: node.Value}
+
+	case *ast.ArrayLiteral:
+		elements := l_evaluator.eval_expression(node.Elements, env)
+		if len(elements) == 1 && is_error(elements[0]) {
+			return elements[0]
+		}
+		l_evaluator.allocate()
+		return &object.Array{Elements: elements}
+
+	case *ast.IndexExpression:
+		result, _ := l_evaluator.eval_chain(node, env)
+		return result
+
+	case *ast.HashLiteral:
+		return l_evaluator.eval_hash_literal(node, env)
+
+	case *ast.MatchExpression:
+		return l_evaluator.eval_match_expression(node, env)
+
+	case *ast.MemberExpression:
+		result, _ := l_evaluator.eval_chain(node, env)
+		return result
 	}
 
 	return nil
 }
 
-func eval_program(program *ast.Program, env *object.Environment) object.Object {
+// Evaluates a call, index or member expression, a link in a chain like a?.b.c(d)[e]. Once an optional
+// member finds null, the links after it are skipped and the whole chain is null, so a?.b.c doesn't go on
+// to read c from null and a?.b(d) doesn't evaluate d. skipped tells the next link the chain was cut short.
+func (l_evaluator *Evaluator) eval_chain(node ast.Expression, env *object.Environment) (result object.Object, skipped bool) {
+	switch node := node.(type) {
+	case *ast.CallExpression:
+		function, skipped := l_evaluator.eval_link(node.Function, env)
+		if skipped || is_error(function) {
+			return function, skipped
+		}
+		args := l_evaluator.eval_expression(node.Arguments, env)
+		if len(args) == 1 && is_error(args[0]) {
+			return args[0], false
+		}
+		if node.Tail {
+			l_evaluator.allocate()
+			return &object.TailCall{Function: function, Arguments: args, Env: env, Position: node.Token.Position}, false
+		}
+		return l_evaluator.apply_function(function, args, env, node.Token.Position), false
+
+	case *ast.IndexExpression:
+		left, skipped := l_evaluator.eval_link(node.Left, env)
+		if skipped || is_error(left) {
+			return left, skipped
+		}
+		index := l_evaluator.eval(node.Index, env)
+		if is_error(index) {
+			return index, false
+		}
+		return eval_index_expression(left, index), false
+
+	case *ast.MemberExpression:
+		left, skipped := l_evaluator.eval_link(node.Object, env)
+		if skipped || is_error(left) {
+			return left, skipped
+		}
+		if node.Optional && left == NULL {
+			return NULL, true
+		}
+		return l_evaluator.eval_member_expression(left, node.Member.Value), false
+	}
+	return l_evaluator.eval(node, env), false
+}
+
+// Evaluates what a link of a chain is applied to, which is the link before it, if there is one.
+func (l_evaluator *Evaluator) eval_link(node ast.Expression, env *object.Environment) (object.Object, bool) {
+	switch node.(type) {
+	case *ast.CallExpression, *ast.IndexExpression, *ast.MemberExpression:
+		if err := l_evaluator.step(); err != nil {
+			return err, false
+		}
+		return l_evaluator.eval_chain(node, env)
+	}
+	return l_evaluator.eval(node, env), false
+}
+
+func (l_evaluator *Evaluator) eval_program(program *ast.Program, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, statement := range program.Statements {
-		result = Eval(statement, env)
+		result = l_evaluator.eval(statement, env)
 
 		switch result := result.(type) {
 		case *object.ReturnValue:
@@ -110,27 +428,106 @@ func eval_program(program *ast.Program, env *object.Environment) object.Object {
 	return result
 }
 
-func apply_function(fn object.Object, args []object.Object) object.Object {
-	switch fn := fn.(type) {
-	case *object.Function:
-		extended_env := extend_function_env(fn, args)
-		evaluated := Eval(fn.Body, extended_env)
-		return unwrap_return_value(evaluated)
+// Calls in tail position come back as an object.TailCall, they are applied here in a loop rather than by
+// recursing so a tail recursive function runs in constant Go stack space.
+//
+// env and position describe the caller, they are handed to builtins in their object.CallContext.
+func (l_evaluator *Evaluator) apply_function(fn object.Object, args []object.Object, env *object.Environment, position token.Position) object.Object {
+	l_evaluator.depth += 1
+	defer func() { l_evaluator.depth -= 1 }()
 
-	case *object.Builtin:
-		return fn.Fn(args...)
+	if max_depth := l_evaluator.options.MaxDepth; max_depth > 0 && l_evaluator.depth > max_depth {
+		return new_limit_error(object.DEPTH_LIMIT_ERROR, "call depth limit exceeded: %d", max_depth)
+	}
 
-	default:
-		return new_error("not a funciton: %s", fn.Type())
+	for {
+		switch function := fn.(type) {
+		case *object.Function:
+			if len(args) != len(function.Parameters) {
+				return new_error("wrong number of arguments, got=%d, want=%d", len(args), len(function.Parameters))
+			}
+			extended_env := l_evaluator.extend_function_env(function, args)
+			evaluated := unwrap_return_value(l_evaluator.eval(function.Body, extended_env))
+
+			if tail_call, ok := evaluated.(*object.TailCall); ok {
+				fn, args = tail_call.Function, tail_call.Arguments
+				env, position = tail_call.Env, tail_call.Position
+				continue
+			}
+			return evaluated
+
+		case *object.Builtin:
+			if err := check_arguments(function, args); err != nil {
+				return err
+			}
+			call := &object.CallContext{
+				Context:  l_evaluator.ctx,
+				Stdout:   l_evaluator.Stdout,
+				Stderr:   l_evaluator.Stderr,
+				Stdin:    l_evaluator.buffered_stdin(),
+				Env:      env,
+				Position: position,
+				Random:   l_evaluator.Random,
+				Files:    l_evaluator.Files,
+				Clock:    l_evaluator.Clock,
+			}
+			call.Apply = func(fn object.Object, args ...object.Object) object.Object {
+				return l_evaluator.apply_function(fn, args, call.Env, call.Position)
+			}
+			call.Allocate = l_evaluator.allocate_many
+			return function.Fn(call, args...)
+
+		case *object.BoundMethod:
+			if err := check_method_arguments(function.Method, args); err != nil {
+				return err
+			}
+			fn, args = function.Method, append([]object.Object{function.Receiver}, args...)
+
+		case *object.StructType:
+			if len(args) != len(function.Fields) {
+				return new_error("wrong number of fields for %s, got=%d, want=%d", function.Name, len(args), len(function.Fields))
+			}
+			l_evaluator.allocate()
+			return &object.StructInstance{Struct: function, Values: append([]object.Object{}, args...)}
+
+		case *object.Variant:
+			if len(args) != len(function.Fields) {
+				return new_error("wrong number of values for %s, got=%d, want=%d", function.Inspect(), len(args), len(function.Fields))
+			}
+			l_evaluator.allocate()
+			return &object.EnumValue{Variant: function, Values: append([]object.Object{}, args...)}
+
+		default:
+			return new_error("not a funciton: %s", fn.Type())
+		}
 	}
+}
 
+// The buffered reader is kept for as long as Stdin stays the same reader.
+func (l_evaluator *Evaluator) buffered_stdin() *bufio.Reader {
+	if reader, ok := l_evaluator.Stdin.(*bufio.Reader); ok {
+		return reader
+	}
+	if l_evaluator.stdin == nil || l_evaluator.stdin_source != l_evaluator.Stdin {
+		l_evaluator.stdin = bufio.NewReader(l_evaluator.Stdin)
+		l_evaluator.stdin_source = l_evaluator.Stdin
+	}
+	return l_evaluator.stdin
 }
 
-func extend_function_env(fn *object.Function, args []object.Object) *object.Environment {
-	env := object.NewEnclosedEnvironment(fn.Env)
+func (l_evaluator *Evaluator) extend_function_env(fn *object.Function, args []object.Object) *object.Environment {
+	l_evaluator.allocate()
+	if fn.Slots < 0 {
+		env := object.NewEnclosedEnvironment(fn.Env)
+		for param_index, param := range fn.Parameters {
+			env.Set(param.Value, args[param_index])
+		}
+		return env
+	}
 
+	env := object.NewSlotEnvironment(fn.Env, fn.Slots)
 	for param_index, param := range fn.Parameters {
-		env.Set(param.Value, args[param_index])
+		env.SetAt(param.Slot, param.Value, args[param_index])
 	}
 	return env
 }
@@ -142,11 +539,11 @@ func unwrap_return_value(obj object.Object) object.Object {
 	return obj
 }
 
-func eval_expression(expressions []ast.Expression, env *object.Environment) []object.Object {
+func (l_evaluator *Evaluator) eval_expression(expressions []ast.Expression, env *object.Environment) []object.Object {
 	var result []object.Object
 
 	for _, e := range expressions {
-		evaluated := Eval(e, env)
+		evaluated := l_evaluator.eval(e, env)
 		if is_error(evaluated) {
 			return []object.Object{evaluated}
 		}
@@ -155,22 +552,26 @@ func eval_expression(expressions []ast.Expression, env *object.Environment) []ob
 	return result
 }
 
-func eval_identifier(node *ast.Identifier, env *object.Environment) object.Object {
-	if val, ok := env.Get(node.Value); ok {
+func (l_evaluator *Evaluator) eval_identifier(node *ast.Identifier, env *object.Environment) object.Object {
+	if node.Resolved {
+		if val, ok := env.GetAt(node.Depth, node.Slot, node.Value); ok {
+			return val
+		}
+	} else if val, ok := env.Get(node.Value); ok {
 		return val
 	}
-	if builtin, ok := builtins[node.Value]; ok {
-		return builtin
+	if value, ok := l_evaluator.Builtins.Value(node.Value); ok {
+		return value
 	}
 
 	return new_error("identifier not found: " + node.Value)
 }
 
-func eval_block_statement(block *ast.BlockStatement, env *object.Environment) object.Object {
+func (l_evaluator *Evaluator) eval_block_statement(block *ast.BlockStatement, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, statement := range block.Statements {
-		result = Eval(statement, env)
+		result = l_evaluator.eval(statement, env)
 
 		if result != nil {
 			rt := result.Type()
@@ -190,12 +591,19 @@ func native_bool_to_boolean_object(input bool) *object.Boolean {
 	return FALSE
 }
 
-func eval_prefix_expression(operator string, right object.Object) object.Object {
+func (l_evaluator *Evaluator) eval_prefix_expression(operator string, right object.Object) object.Object {
 	switch operator {
 	case "!":
 		return eval_bang_operator_expression(right)
 	case "-":
-		return eval_minus_prefix_operator_expression(right)
+		return l_evaluator.eval_minus_prefix_operator_expression(right)
+	case "~":
+		integer, ok := right.(*object.Integer)
+		if !ok {
+			return new_error("unknown operator: ~%s", right.Type())
+		}
+		l_evaluator.allocate()
+		return &object.Integer{Value: ^integer.Value}
 
 	default:
 		return new_error("unknown operator: %s%s", operator, right.Type())
@@ -218,38 +626,100 @@ func eval_bang_operator_expression(right object.Object) object.Object {
 	}
 }
 
-func eval_minus_prefix_operator_expression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJECT {
+func (l_evaluator *Evaluator) eval_minus_prefix_operator_expression(right object.Object) object.Object {
+	switch right := right.(type) {
+	case *object.Integer:
+		l_evaluator.allocate()
+		return &object.Integer{Value: -right.Value}
+	case *object.Float:
+		l_evaluator.allocate()
+		return &object.Float{Value: -right.Value}
+	default:
 		return new_error("unknown operator: -%s", right.Type())
 	}
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
 }
 
-func eval_infix_expression(operator string, left object.Object, right object.Object) object.Object {
+func (l_evaluator *Evaluator) eval_infix_expression(operator string, left object.Object, right object.Object) object.Object {
 	switch {
+	case operator == "is":
+		return eval_is_expression(left, right)
+
 	case left.Type() == object.INTEGER_OBJECT && right.Type() == object.INTEGER_OBJECT:
-		return eval_integer_infix_expression(operator, left, right)
+		return l_evaluator.eval_integer_infix_expression(operator, left, right)
+
+	case is_number(left) && is_number(right):
+		return l_evaluator.eval_float_infix_expression(operator, left, right)
+
+	case left.Type() == object.STRING_OBJECT && right.Type() == object.STRING_OBJECT:
+		return l_evaluator.eval_string_infix_expression(operator, left, right)
 
 	case operator == "==":
-		return native_bool_to_boolean_object(left == right)
+		return native_bool_to_boolean_object(objects_equal(left, right))
 
 	case operator == "!=":
-		return native_bool_to_boolean_object(left != right)
+		return native_bool_to_boolean_object(!objects_equal(left, right))
 
 	case left.Type() != right.Type():
 		return new_error("type mismatch: %s %s %s", left.Type(), operator, right.Type())
 
-	case left.Type() == object.STRING_OBJECT && right.Type() == object.STRING_OBJECT:
-		return eval_string_infix_expression(operator, left, right)
 	default:
 		return new_error("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
-func eval_integer_infix_expression(operator string, left object.Object, right object.Object) object.Object {
+// a ?? b is a unless a is null, and only then is b evaluated.
+func (l_evaluator *Evaluator) eval_nullish_expression(node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := l_evaluator.eval(node.Left, env)
+	if is_error(left) || left != NULL {
+		return left
+	}
+	return l_evaluator.eval(node.Right, env)
+}
+
+// value is Result, value is Result.Ok, value is Status.Pending or value is Point.
+func eval_is_expression(value object.Object, kind object.Object) object.Object {
+	enum_value, is_enum_value := value.(*object.EnumValue)
+	switch kind := kind.(type) {
+	case *object.EnumType:
+		return native_bool_to_boolean_object(is_enum_value && enum_value.Variant.Enum == kind)
+	case *object.Variant:
+		return native_bool_to_boolean_object(is_enum_value && enum_value.Variant == kind)
+	case *object.EnumValue:
+		if len(kind.Values) == 0 {
+			return native_bool_to_boolean_object(is_enum_value && enum_value.Variant == kind.Variant)
+		}
+	case *object.StructType:
+		instance, ok := value.(*object.StructInstance)
+		return native_bool_to_boolean_object(ok && instance.Struct == kind)
+	}
+	return new_error("is needs a struct, an enum or a variant on its right, got %s", kind.Inspect())
+}
+
+// && and || only evaluate their right side when the left one doesn't decide the result, so
+// `i < len(arr) && arr[i] > 0` never indexes past the end. Both give a boolean.
+func (l_evaluator *Evaluator) eval_logical_expression(node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := l_evaluator.eval(node.Left, env)
+	if is_error(left) {
+		return left
+	}
+	if node.Operator == "&&" && !is_truthy(left) {
+		return FALSE
+	}
+	if node.Operator == "||" && is_truthy(left) {
+		return TRUE
+	}
+
+	right := l_evaluator.eval(node.Right, env)
+	if is_error(right) {
+		return right
+	}
+	return native_bool_to_boolean_object(is_truthy(right))
+}
+
+func (l_evaluator *Evaluator) eval_integer_infix_expression(operator string, left object.Object, right object.Object) object.Object {
 	left_value := left.(*object.Integer).Value
 	right_value := right.(*object.Integer).Value
+	l_evaluator.allocate()
 
 	switch operator {
 	case "+":
@@ -262,14 +732,53 @@ func eval_integer_infix_expression(operator string, left object.Object, right ob
 		return &object.Integer{Value: left_value * right_value}
 
 	case "/":
+		if right_value == 0 {
+			return new_error("division by zero")
+		}
 		return &object.Integer{Value: left_value / right_value}
 
+	case "%":
+		if right_value == 0 {
+			return new_error("modulo by zero")
+		}
+		return &object.Integer{Value: left_value % right_value}
+
+	case "**":
+		if right_value < 0 {
+			return &object.Float{Value: math.Pow(float64(left_value), float64(right_value))}
+		}
+		return &object.Integer{Value: integer_power(left_value, right_value)}
+
+	case "&":
+		return &object.Integer{Value: left_value & right_value}
+
+	case "|":
+		return &object.Integer{Value: left_value | right_value}
+
+	case "^":
+		return &object.Integer{Value: left_value ^ right_value}
+
+	case "<<", ">>":
+		if right_value < 0 {
+			return new_error("negative shift count: %d", right_value)
+		}
+		if operator == "<<" {
+			return &object.Integer{Value: left_value << right_value}
+		}
+		return &object.Integer{Value: left_value >> right_value}
+
 	case "<":
 		return native_bool_to_boolean_object(left_value < right_value)
 
 	case ">":
 		return native_bool_to_boolean_object(left_value > right_value)
 
+	case "<=":
+		return native_bool_to_boolean_object(left_value <= right_value)
+
+	case ">=":
+		return native_bool_to_boolean_object(left_value >= right_value)
+
 	case "==":
 		return native_bool_to_boolean_object(left_value == right_value)
 
@@ -281,30 +790,150 @@ func eval_integer_infix_expression(operator string, left object.Object, right ob
 	}
 }
 
-func eval_if_expression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ie.Condition, env)
+func (l_evaluator *Evaluator) eval_hash_literal(node *ast.HashLiteral, env *object.Environment) object.Object {
+	hash := object.NewHash()
+
+	for _, pair := range node.Pairs {
+		key := l_evaluator.eval(pair.Key, env)
+		if is_error(key) {
+			return key
+		}
+		hashable, ok := key.(object.Hashable)
+		if !ok {
+			return new_error("unusable as hash key: %s", key.Type())
+		}
+
+		value := l_evaluator.eval(pair.Value, env)
+		if is_error(value) {
+			return value
+		}
+		hash.Pairs[hashable.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	l_evaluator.allocate()
+	return hash
+}
+
+// Indexing an array out of its bounds, or a hash with a key it doesn't have, gives null.
+func eval_index_expression(left, index object.Object) object.Object {
+	switch {
+	case left.Type() == object.ARRAY_OBJECT && index.Type() == object.INTEGER_OBJECT:
+		elements := left.(*object.Array).Elements
+		i := index.(*object.Integer).Value
+		if i < 0 || i >= int64(len(elements)) {
+			return NULL
+		}
+		return elements[i]
+
+	case left.Type() == object.HASH_OBJECT:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return new_error("unusable as hash key: %s", index.Type())
+		}
+		pair, ok := left.(*object.Hash).Pairs[key.HashKey()]
+		if !ok {
+			return NULL
+		}
+		return pair.Value
+
+	default:
+		return new_error("index operator not supported: %s[%s]", left.Type(), index.Type())
+	}
+}
+
+// An integer mixed with a float is turned into a float first, so 1 + 0.5 is 1.5 and 1 == 1.0.
+func (l_evaluator *Evaluator) eval_float_infix_expression(operator string, left, right object.Object) object.Object {
+	left_value := to_float(left)
+	right_value := to_float(right)
+
+	switch operator {
+	case "+":
+		l_evaluator.allocate()
+		return &object.Float{Value: left_value + right_value}
+	case "-":
+		l_evaluator.allocate()
+		return &object.Float{Value: left_value - right_value}
+	case "*":
+		l_evaluator.allocate()
+		return &object.Float{Value: left_value * right_value}
+	case "/":
+		l_evaluator.allocate()
+		return &object.Float{Value: left_value / right_value}
+	case "%":
+		l_evaluator.allocate()
+		return &object.Float{Value: math.Mod(left_value, right_value)}
+	case "**":
+		l_evaluator.allocate()
+		return &object.Float{Value: math.Pow(left_value, right_value)}
+	case "<":
+		return native_bool_to_boolean_object(left_value < right_value)
+	case ">":
+		return native_bool_to_boolean_object(left_value > right_value)
+	case "<=":
+		return native_bool_to_boolean_object(left_value <= right_value)
+	case ">=":
+		return native_bool_to_boolean_object(left_value >= right_value)
+	case "==":
+		return native_bool_to_boolean_object(left_value == right_value)
+	case "!=":
+		return native_bool_to_boolean_object(left_value != right_value)
+	default:
+		return new_error("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func is_number(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJECT || obj.Type() == object.FLOAT_OBJECT
+}
+
+// The value of an INTEGER or FLOAT as a float64.
+func to_float(obj object.Object) float64 {
+	if integer, ok := obj.(*object.Integer); ok {
+		return float64(integer.Value)
+	}
+	return obj.(*object.Float).Value
+}
+
+func (l_evaluator *Evaluator) eval_if_expression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := l_evaluator.eval(ie.Condition, env)
 
 	if is_error(condition) {
 		return condition
 	}
 
 	if is_truthy(condition) {
-		return Eval(ie.Consequence, env)
+		return l_evaluator.eval(ie.Consequence, env)
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return l_evaluator.eval(ie.Alternative, env)
 	} else {
 		return NULL
 	}
 }
 
-func eval_string_infix_expression(operator string, left, right object.Object) object.Object {
-	if operator != "+" {
-		return new_error("unknown operator: %s %s %s", left.Type(), operator, right.Type())
-	}
-
+// Strings are compared by value, byte by byte, not by which object they are.
+func (l_evaluator *Evaluator) eval_string_infix_expression(operator string, left, right object.Object) object.Object {
 	left_value := left.(*object.String).Value
 	right_value := right.(*object.String).Value
-	return &object.String{Value: left_value + right_value}
+
+	switch operator {
+	case "+":
+		l_evaluator.allocate()
+		return &object.String{Value: left_value + right_value}
+	case "<":
+		return native_bool_to_boolean_object(left_value < right_value)
+	case ">":
+		return native_bool_to_boolean_object(left_value > right_value)
+	case "<=":
+		return native_bool_to_boolean_object(left_value <= right_value)
+	case ">=":
+		return native_bool_to_boolean_object(left_value >= right_value)
+	case "==":
+		return native_bool_to_boolean_object(left_value == right_value)
+	case "!=":
+		return native_bool_to_boolean_object(left_value != right_value)
+	default:
+		return new_error("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
 }
 
 func is_truthy(object object.Object) bool {
@@ -324,7 +953,15 @@ func is_truthy(object object.Object) bool {
 }
 
 func new_error(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+	return &object.Error{Kind: object.RUNTIME_ERROR, Message: fmt.Sprintf(format, a...)}
+}
+
+func new_permission_error(format string, a ...interface{}) *object.Error {
+	return &object.Error{Kind: object.PERMISSION_ERROR, Message: fmt.Sprintf(format, a...)}
+}
+
+func new_limit_error(kind object.ErrorKind, format string, a ...interface{}) *object.Error {
+	return &object.Error{Kind: kind, Message: fmt.Sprintf(format, a...)}
 }
 
 func is_error(l_object object.Object) bool {
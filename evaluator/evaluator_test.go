@@ -1,10 +1,18 @@
 package evaluator
 
 import (
+	"bytes"
+	"context"
+	"math"
 	"monna/lexer"
 	"monna/object"
 	"monna/parser"
+	"monna/resolver"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestEvalIntegerExpression(l_test *testing.T) {
@@ -28,6 +36,21 @@ func TestEvalIntegerExpression(l_test *testing.T) {
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
 		{"8 * (4 + 32 - (64 / 2) + 5) / (100 / 2 + (25 - 10 + 15) * 18)", 0},
+		{"17 % 5", 2},
+		{"-17 % 5", -2},
+		{"2 + 10 % 4 * 3", 8},
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+		{"(-2) ** 2", 4},
+		{"7 ** 0", 1},
+		{"12 & 10", 8},
+		{"12 | 10", 14},
+		{"12 ^ 10", 6},
+		{"~5", -6},
+		{"1 << 10", 1024},
+		{"-16 >> 2", -4},
+		{"1 << 2 + 1", 8},
 	}
 
 	for _, tt := range tests {
@@ -44,6 +67,11 @@ func TestErrorHandling(l_test *testing.T) {
 		{"5 + true;", "type mismatch: INTEGER + BOOLEAN"},
 		{"5 + true; 5;", "type mismatch: INTEGER + BOOLEAN"},
 		{"-true;", "unknown operator: -BOOLEAN"},
+		{"~1.5;", "unknown operator: ~FLOAT"},
+		{"5 % 0;", "modulo by zero"},
+		{"1 << -1;", "negative shift count: -1"},
+		{"8 >> -2;", "negative shift count: -2"},
+		{"1.5 & 1;", "unknown operator: FLOAT & INTEGER"},
 		{"true + false;", "unknown operator: BOOLEAN + BOOLEAN"},
 		{"5; true + false; 5", "unknown operator: BOOLEAN + BOOLEAN"},
 		{"if (10 > 1) {true + false; }", "unknown operator: BOOLEAN + BOOLEAN"},
@@ -101,6 +129,22 @@ func TestEvalBooleanExpression(l_test *testing.T) {
 		{"(1 < 2) == false", false},
 		{"(1 > 2) == true", false},
 		{"(1 > 2) == false", true},
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 >= 2", false},
+		{"1.5 >= 1", true},
+		{`"a" <= "b"`, true},
+		{`"b" >= "c"`, false},
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 < 2 && 2 < 3", true},
+		{"1 > 2 || 2 > 3", false},
+		{`1 && "yes"`, true},
+		{"0 || null_value", true},
+		{"6 & 3 == 2", true},
+		{"7 % 2 == 1 && 8 % 2 == 0", true},
 	}
 
 	for _, tt := range tests {
@@ -109,6 +153,25 @@ func TestEvalBooleanExpression(l_test *testing.T) {
 	}
 }
 
+func TestShortCircuit(l_test *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"false && missing()", "false"},
+		{"true || missing()", "true"},
+		{"let arr = [1]; let i = 1; i < len(arr) && arr[i] > 0", "false"},
+		{"true && missing()", "ERROR: identifier not found: missing"},
+		{"false || 1 / 0", "ERROR: division by zero"},
+	}
+	for _, tt := range tests {
+		evaluated := test_eval(tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			l_test.Errorf("%s: expected=%s, got=%v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
 // Test to convert the '!' operator to boolean value and negate it
 func TestBangOperator(l_test *testing.T) {
 	tests := []struct {
@@ -188,6 +251,42 @@ func TestLetStatements(l_test *testing.T) {
 	}
 }
 
+func TestDestructuringLetStatements(l_test *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let [a, b] = [1, 2]; a + b", "3"},
+		{"let [first, ...rest] = [1, 2, 3]; rest", "[2, 3]"},
+		{"let [x, ...] = [1, 2, 3]; x", "1"},
+		{"let [_, second] = [1, 2]; second", "2"},
+		{`let {name, age} = {"name": "Ada", "age": 36}; name + " " + format("%v", age)`, "Ada 36"},
+		{`let {"full name": full, address: {city}} = {"full name": "Ada L", "address": {"city": "London"}}; full + ", " + city`, "Ada L, London"},
+		{"let f = fn(pair) { let [k, v] = pair; k * v }; f([3, 4])", "12"},
+		{"let [a, b] = [1]; a", "ERROR: cannot destructure [1]: expected an array of 2 elements, got 1"},
+		{"let [a, b, ...rest] = [1]; a", "ERROR: cannot destructure [1]: expected an array of at least 2 elements, got 1"},
+		{"let [a] = 5; a", "ERROR: cannot destructure 5: expected an array, got INTEGER"},
+		{`let {name} = [1]; name`, "ERROR: cannot destructure [1]: expected a hash, got ARRAY"},
+		{`let {name, age} = {"name": "Ada"}; name`, `ERROR: cannot destructure {name: Ada}: missing key "age"`},
+		{`let [a, [b, 2]] = [1, [2, 3]]; a`, "ERROR: cannot destructure [1, [2, 3]]: expected 2, got 3"},
+	}
+
+	for _, tt := range tests {
+		for _, evaluated := range []object.Object{test_eval(tt.input), test_eval_resolved(l_test, tt.input)} {
+			if evaluated == nil || evaluated.Inspect() != tt.expected {
+				l_test.Errorf("%s: expected=%s, got=%v", tt.input, tt.expected, evaluated)
+			}
+		}
+	}
+
+	// Nothing is bound when the value doesn't fit.
+	env := object.NewEnvironment()
+	New().Eval(parser.New(lexer.New("let a = 0; let [a, b] = [1];")).ParseProgram(), env)
+	if a, _ := env.Get("a"); a.Inspect() != "0" {
+		l_test.Errorf("expected a to stay 0, got=%v", a)
+	}
+}
+
 func TestFunctionObject(l_test *testing.T) {
 	input := "fn(x) { x + 2;};"
 	evaluated := test_eval(input)
@@ -241,6 +340,48 @@ func TestClosures(l_test *testing.T) {
 	test_integer_object(l_test, test_eval(input), 4)
 }
 
+func TestArrowFunctionsAndDeclarations(l_test *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"map([1, 2, 3], x => x * 2)", "[2, 4, 6]"},
+		{"reduce([1, 2, 3], (a, b) => a + b)", "6"},
+		{"let answer = () => 42; answer()", "42"},
+		{"let add = a => b => a + b; add(1)(2)", "3"},
+		{"let f = x => { let y = x * 10; y + 1 }; f(2)", "21"},
+		{"[3, 1, 2].sort((a, b) => a > b)", "[3, 2, 1]"},
+		{"fn add(a, b) { a + b } add(2, 3)", "5"},
+		{"fn fact(n) { if (n < 2) { 1 } else { n * fact(n - 1) } } fact(10)", "3628800"},
+		{"fn is_even(n) { if (n == 0) { true } else { is_odd(n - 1) } } fn is_odd(n) { if (n == 0) { false } else { is_even(n - 1) } } [is_even(10), is_odd(7), is_even(3)]", "[true, true, false]"},
+		{"let outer = fn(x) { fn inner(y) { x + y } inner(1) }; outer(41)", "42"},
+		{"fn twice(f, x) { f(f(x)) } twice(x => x * 3, 2)", "18"},
+		{"match (4) { n if any([1, 4], x => x == n) => \"found\", _ => \"missing\" }", "found"},
+		{"(a, b) => a", "fn(a, b) {\na\n}"},
+		{"let f = x => x; f(1, 2)", "ERROR: wrong number of arguments, got=2, want=1"},
+	}
+
+	for _, tt := range tests {
+		for _, evaluated := range []object.Object{test_eval(tt.input), test_eval_resolved(l_test, tt.input)} {
+			if evaluated == nil || evaluated.Inspect() != tt.expected {
+				l_test.Errorf("%s: expected=%s, got=%v", tt.input, tt.expected, evaluated)
+			}
+		}
+	}
+
+	// Mutually recursive declarations call each other in tail position, and arrow bodies are tail positions
+	// too.
+	input := `fn is_even(n) { if (n == 0) { true } else { is_odd(n - 1) } }
+	fn is_odd(n) { if (n == 0) { false } else { is_even(n - 1) } }
+	let count = (n, total) => if (n == 0) { total } else { count(n - 1, total + 1) };
+	[is_even(10001), count(5000, 0)]`
+	program := parser.New(lexer.New(input)).ParseProgram()
+	evaluated := EvalContext(context.Background(), program, object.NewEnvironment(), Options{MaxDepth: 10})
+	if evaluated.Inspect() != "[false, 5000]" {
+		l_test.Errorf("expected [false, 5000], got=%v", evaluated)
+	}
+}
+
 func TestStringLiteral(l_test *testing.T) {
 	input := `"Hello World!";`
 
@@ -301,7 +442,1307 @@ func TestBuiltinFunction(l_test *testing.T) {
 	}
 }
 
+func TestStringBuiltins(l_test *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`join(split("a,b,c", ","), "-")`, "a-b-c"},
+		{`len(split("abc", ""))`, 3},
+		{`join(split("a b", " "), "")`, "ab"},
+		{`trim("  monna  ")`, "monna"},
+		{`trim("--monna--", "-")`, "monna"},
+		{`upper("monna")`, "MONNA"},
+		{`lower("MoNNa")`, "monna"},
+		{`replace("a-b-c", "-", "+")`, "a+b+c"},
+		{`contains("monkey", "key")`, true},
+		{`starts_with("monkey", "mon")`, true},
+		{`ends_with("monkey", "mon")`, false},
+		{`index_of("monkey", "key")`, 3},
+		{`index_of("monkey", "z")`, -1},
+		{`substr("monkey", 1, 3)`, "on"},
+		{`substr("monkey", 3)`, "key"},
+		{`substr("monkey", -3, -1)`, "ke"},
+		{`substr("monkey", 4, 100)`, "ey"},
+		{`substr("monkey", 4, 2)`, ""},
+		{`repeat("ab", 3)`, "ababab"},
+		{`format("%05d|%-4s|%v|%x", 42, "ab", true, 255)`, "00042|ab  |true|ff"},
+		{`format("%s", split("a,b", ","))`, "[a, b]"},
+		{`repeat("ab", -1)`, expected_error("argument 2 to `repeat` must not be negative, got -1")},
+		{`repeat("ab", 9223372036854775807)`, expected_error("repeat result is too large: 2 bytes times 9223372036854775807")},
+		{`repeat("", 9223372036854775807)`, ""},
+		{`upper(1)`, expected_error("argument 1 to `upper` must be STRING, got INTEGER")},
+		{`format()`, expected_error("wrong number of arguments, got=0, want=at least 1")},
+	}
+
+	for _, tt := range tests {
+		evaluated := test_eval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			test_integer_object(l_test, evaluated, int64(expected))
+		case bool:
+			test_boolean_object(l_test, evaluated, expected)
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				l_test.Errorf("%s: object is not String, got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				l_test.Errorf("%s: wrong value, expected=%q, got=%q", tt.input, expected, str.Value)
+			}
+		case expected_error:
+			error_object, ok := evaluated.(*object.Error)
+			if !ok {
+				l_test.Errorf("%s: object is not Error, got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if error_object.Message != string(expected) {
+				l_test.Errorf("wrong error message, expected=%q, got=%q", expected, error_object.Message)
+			}
+		}
+	}
+}
+
+func TestStringComparison(l_test *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"a" == "a"`, true},
+		{`"a" + "b" == "ab"`, true},
+		{`"a" != "a"`, false},
+		{`"a" != "b"`, true},
+		{`"a" < "b"`, true},
+		{`"b" < "a"`, false},
+		{`"abc" > "abd"`, false},
+		{`"b" > "abc"`, true},
+		{`let a = "x"; let b = "x"; a == b`, true},
+	}
+
+	for _, tt := range tests {
+		test_boolean_object(l_test, test_eval(tt.input), tt.expected)
+	}
+}
+
+func TestArrayLiterals(l_test *testing.T) {
+	evaluated := test_eval("[1, 2 * 2, 3 + 3]")
+	result, ok := evaluated.(*object.Array)
+	if !ok {
+		l_test.Fatalf("object is not Array, got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(result.Elements) != 3 {
+		l_test.Fatalf("array has wrong number of elements, got=%d", len(result.Elements))
+	}
+	test_integer_object(l_test, result.Elements[0], 1)
+	test_integer_object(l_test, result.Elements[1], 4)
+	test_integer_object(l_test, result.Elements[2], 6)
+}
+
+func TestArrayIndexExpressions(l_test *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3][0]", 1},
+		{"[1, 2, 3][1 + 1]", 3},
+		{"let my_array = [1, 2, 3]; my_array[0] + my_array[1] + my_array[2];", 6},
+		{"let i = 0; [1][i];", 1},
+		{"[1, 2, 3][3]", nil},
+		{"[1, 2, 3][-1]", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := test_eval(tt.input)
+		if integer, ok := tt.expected.(int); ok {
+			test_integer_object(l_test, evaluated, int64(integer))
+		} else {
+			test_null_object(l_test, evaluated)
+		}
+	}
+}
+
+func TestCollectionBuiltins(l_test *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"map([1, 2, 3], fn(x) { x * 2 })", "[2, 4, 6]"},
+		{`map(["a", "b"], upper)`, "[A, B]"},
+		{"filter([1, 2, 3, 4], fn(x) { x > 2 })", "[3, 4]"},
+		{"reduce([1, 2, 3, 4], fn(total, x) { total + x })", "10"},
+		{"reduce([], fn(total, x) { total + x }, 5)", "5"},
+		{`reduce(["a", "b"], fn(s, x) { s + x }, "")`, "ab"},
+		{"let total = fn(xs) { reduce(xs, fn(a, b) { a * b }, 1) }; total(range(1, 6))", "120"},
+		{"each([1, 2], fn(x) { x })", "null"},
+		{"sort([3, 1, 2])", "[1, 2, 3]"},
+		{`sort(["b", "c", "a"])`, "[a, b, c]"},
+		{"sort([3, 1, 2], fn(a, b) { a > b })", "[3, 2, 1]"},
+		{"zip([1, 2, 3], [4, 5])", "[[1, 4], [2, 5]]"},
+		{"range(3)", "[0, 1, 2]"},
+		{"range(2, 5)", "[2, 3, 4]"},
+		{"range(5, 0, -2)", "[5, 3, 1]"},
+		{"range(5, 5)", "[]"},
+		{"range(-9223372036854775807, 9223372036854775807, 9223372036854775807)", "[-9223372036854775807, 0]"},
+		{"find([1, 2, 3], fn(x) { x > 1 })", "2"},
+		{"find([1, 2, 3], fn(x) { x > 5 })", "null"},
+		{"any([1, 2, 3], fn(x) { x == 2 })", "true"},
+		{"any([], fn(x) { true })", "false"},
+		{"all([1, 2, 3], fn(x) { x > 0 })", "true"},
+		{"all([1, 2, 3], fn(x) { x > 1 })", "false"},
+		{"let xs = [3, 1, 2]; sort(xs); xs", "[3, 1, 2]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := test_eval_resolved(l_test, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			l_test.Errorf("%s: expected=%s, got=%v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestCollectionCallbackErrors(l_test *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"map([1, 2], fn(x) { x + true })", "type mismatch: INTEGER + BOOLEAN"},
+		{"filter([1], fn(x) { missing(x) })", "identifier not found: missing"},
+		{"map([1], fn(a, b) { a })", "wrong number of arguments, got=1, want=2"},
+		{"map([1], 5)", "not a funciton: INTEGER"},
+		{`map([1], upper)`, "argument 1 to `upper` must be STRING, got INTEGER"},
+		{"sort([1, 2], fn(a, b) { 1 })", "sort comparator must return BOOLEAN, got INTEGER"},
+		{`sort([1, "a"])`, "sort without a comparator needs an array of numbers or of strings, got STRING"},
+		{"reduce([], fn(a, b) { a })", "reduce of empty array with no initial value"},
+		{"range(0, 10, 0)", "range step must not be zero"},
+		{"range(9223372036854775807)", "range is too large: 9223372036854775807 elements"},
+	}
+
+	for _, tt := range tests {
+		evaluated := test_eval(tt.input)
+		error_object, ok := evaluated.(*object.Error)
+		if !ok {
+			l_test.Errorf("%s: object is not Error, got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if error_object.Message != tt.expected {
+			l_test.Errorf("wrong error message, expected=%q, got=%q", tt.expected, error_object.Message)
+		}
+	}
+
+	program := parser.New(lexer.New("map(range(100), fn(x) { x * 2 })")).ParseProgram()
+	result := EvalContext(context.Background(), program, object.NewEnvironment(), Options{MaxSteps: 50})
+	if err, ok := result.(*object.Error); !ok || err.Kind != object.STEP_LIMIT_ERROR {
+		l_test.Errorf("expected the step limit to stop callbacks, got=%v", result)
+	}
+}
+
+func TestFloatExpressions(l_test *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1.5", "1.5"},
+		{"-2.5", "-2.5"},
+		{"1.5 + 1.5", "3.0"},
+		{"1 + 0.5", "1.5"},
+		{"10 / 4.0", "2.5"},
+		{"2.0 * 3", "6.0"},
+		{"0.1 + 0.2 > 0.3", "true"},
+		{"1 == 1.0", "true"},
+		{"1.0 != 2", "true"},
+		{"1.0 / 0", "+Inf"},
+		{"0.000000001", "1e-09"},
+		{"100000000.0", "100000000.0"},
+		{"7.5 % 2", "1.5"},
+		{"2 ** 0.5 > 1.41", "true"},
+		{"2 ** -1", "0.5"},
+		{"1.5 ** 2", "2.25"},
+	}
+
+	for _, tt := range tests {
+		evaluated := test_eval(tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			l_test.Errorf("%s: expected=%s, got=%v", tt.input, tt.expected, evaluated)
+		}
+	}
+
+	evaluated := test_eval("1 / 0")
+	if err, ok := evaluated.(*object.Error); !ok || err.Message != "division by zero" {
+		l_test.Errorf("expected a division by zero error, got=%v", evaluated)
+	}
+}
+
+func TestMathBuiltins(l_test *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"math.abs(-5)", "5"},
+		{"math.abs(-2.5)", "2.5"},
+		{"math.min(3, 1.5, 2)", "1.5"},
+		{"math.max(3, 1, 2)", "3"},
+		{"math.pow(2, 10)", "1024"},
+		{"math.pow(2, -1)", "0.5"},
+		{"math.pow(4, 0.5)", "2.0"},
+		{"math.sqrt(16)", "4.0"},
+		{"math.floor(2.7)", "2"},
+		{"math.ceil(2.1)", "3"},
+		{"math.round(2.5)", "3"},
+		{"math.round(-2.5)", "-3"},
+		{"math.round(7)", "7"},
+		{"math.sin(0)", "0.0"},
+		{"math.cos(0)", "1.0"},
+		{"math.atan2(1, 1) * 4 == math.pi", "true"},
+		{"math.floor(math.e * 100)", "271"},
+		{"format(\"%.2f\", math.pi)", "3.14"},
+		{"sort([2.5, 1, 2])", "[1, 2, 2.5]"},
+		{"math.sqrt(-1)", "sqrt of negative number: -1"},
+		{"math.floor(1.0 / 0)", "cannot floor +Inf to an integer"},
+		{"math.random(5, 5)", "random range is empty: [5, 5)"},
+		{`math.abs("1")`, "argument 1 to `abs` must be NUMBER, got STRING"},
+		{"let min = 1; let e = 2; math.min(min, e, 0)", "0"},
+		{"pi", "identifier not found: pi"},
+		{"math.tau", "module math does not export tau"},
+	}
+
+	for _, tt := range tests {
+		evaluated := test_eval(tt.input)
+		if err, ok := evaluated.(*object.Error); ok {
+			if err.Message != tt.expected {
+				l_test.Errorf("%s: expected=%s, got error %q", tt.input, tt.expected, err.Message)
+			}
+			continue
+		}
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			l_test.Errorf("%s: expected=%s, got=%v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestSeededRandom(l_test *testing.T) {
+	input := "math.seed(42); [math.random(), math.random(10), math.random(-5, 5)]"
+
+	first := test_eval(input).Inspect()
+	second := test_eval(input).Inspect()
+	if first != second {
+		l_test.Errorf("expected the same numbers after seeding, got=%s and %s", first, second)
+	}
+
+	for i := 0; i < 100; i++ {
+		number := test_eval("math.random(-5, 5)").(*object.Integer).Value
+		if number < -5 || number >= 5 {
+			l_test.Fatalf("random(-5, 5) out of range, got=%d", number)
+		}
+	}
+
+	// A range wider than the largest integer doesn't overflow.
+	for i := 0; i < 100; i++ {
+		evaluated := test_eval("math.random(-9223372036854775807, 9223372036854775807)")
+		if number, ok := evaluated.(*object.Integer); !ok || number.Value == math.MaxInt64 {
+			l_test.Fatalf("random over the whole integer range failed, got=%v", evaluated)
+		}
+	}
+
+	l_evaluator := New()
+	l_evaluator.Random.Seed(42)
+	hosted := l_evaluator.Eval(parser.New(lexer.New("[math.random(), math.random(10), math.random(-5, 5)]")).ParseProgram(), object.NewEnvironment())
+	if hosted.Inspect() != first {
+		l_test.Errorf("expected seeding Random to match seed(), got=%s and %s", hosted.Inspect(), first)
+	}
+}
+
+func TestHashLiterals(l_test *testing.T) {
+	input := `let two = "two";
+	{
+		"one": 10 - 9,
+		two: 1 + 1,
+		"thr" + "ee": 6 / 2,
+		4: 4,
+		true: 5,
+		false: 6
+	}`
+
+	evaluated := test_eval(input)
+	result, ok := evaluated.(*object.Hash)
+	if !ok {
+		l_test.Fatalf("eval didn't return Hash, got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expected := map[object.HashKey]int64{
+		(&object.String{Value: "one"}).HashKey():   1,
+		(&object.String{Value: "two"}).HashKey():   2,
+		(&object.String{Value: "three"}).HashKey(): 3,
+		(&object.Integer{Value: 4}).HashKey():      4,
+		TRUE.HashKey():                             5,
+		FALSE.HashKey():                            6,
+	}
+	if len(result.Pairs) != len(expected) {
+		l_test.Fatalf("hash has wrong number of pairs, got=%d", len(result.Pairs))
+	}
+	for key, value := range expected {
+		pair, ok := result.Pairs[key]
+		if !ok {
+			l_test.Errorf("no pair for given key in Pairs")
+		}
+		test_integer_object(l_test, pair.Value, value)
+	}
+}
+
+func TestHashIndexExpressions(l_test *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, nil},
+		{`let key = "foo"; {"foo": 5}[key]`, 5},
+		{`{}["foo"]`, nil},
+		{`{5: 5}[5]`, 5},
+		{`{true: 5}[true]`, 5},
+		{`{"name": "monna"}[fn(x) { x }]`, "unusable as hash key: FUNCTION"},
+		{`{[1]: 1}`, "unusable as hash key: ARRAY"},
+	}
+
+	for _, tt := range tests {
+		evaluated := test_eval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			test_integer_object(l_test, evaluated, int64(expected))
+		case string:
+			if err, ok := evaluated.(*object.Error); !ok || err.Message != expected {
+				l_test.Errorf("%s: expected error %q, got=%v", tt.input, expected, evaluated)
+			}
+		default:
+			test_null_object(l_test, evaluated)
+		}
+	}
+}
+
+func TestJSONBuiltins(l_test *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`json_encode({"name": "monna", "tags": ["a", "b"], "version": 1.5, "stable": false})`, `{"name":"monna","stable":false,"tags":["a","b"],"version":1.5}`},
+		{`json_encode([1, "<b>", find([], fn(x) { true })])`, `[1,"<b>",null]`},
+		{`json_encode({"a": [1]}, 2)`, "{\n  \"a\": [\n    1\n  ]\n}"},
+		{`json_encode([1, 2], 100000000000)`, "argument 2 to `json_encode` must be between 0 and 16, got 100000000000"},
+		{`json_encode([1, 2], -1)`, "argument 2 to `json_encode` must be between 0 and 16, got -1"},
+		{`json_decode("{\"a\": [1, 2.5, true, null, \"x\"]}")["a"]`, "[1, 2.5, true, null, x]"},
+		{`json_decode("12345678901234567890")`, "12345678901234567000.0"},
+		{`let config = json_decode(json_encode({"port": 8080})); config["port"] + 1`, "8081"},
+		{`json_encode({"f": fn(x) { x }})`, "json_encode: cannot encode FUNCTION at $.f"},
+		{`json_encode([1, [len]])`, "json_encode: cannot encode BUILTIN at $[1][0]"},
+		{`json_encode({1: 2})`, "json_encode: hash key must be STRING, got INTEGER at $"},
+		{`json_encode(1.0 / 0)`, "json_encode: cannot encode +Inf at $"},
+		{`json_decode("{\"a\": x}")`, "json_decode: invalid character 'x' looking for beginning of value at offset 7"},
+		{`json_decode("[1, 2")`, "json_decode: unexpected end of input at offset 5"},
+		{`json_decode("1 2")`, "json_decode: unexpected data after the value at offset 3"},
+	}
+
+	for _, tt := range tests {
+		evaluated := test_eval(tt.input)
+		if err, ok := evaluated.(*object.Error); ok {
+			if err.Message != tt.expected {
+				l_test.Errorf("%s: expected=%q, got error %q", tt.input, tt.expected, err.Message)
+			}
+			continue
+		}
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			l_test.Errorf("%s: expected=%q, got=%v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestTry(l_test *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`try(fn() { 1 + 1 }, fn(err) { 0 })`, "2"},
+		{`try(fn() { 1 + true }, fn(err) { err["message"] })`, "type mismatch: INTEGER + BOOLEAN"},
+		{`try(fn() { read_file("x") }, fn(err) { err["kind"] })`, "PERMISSION"},
+		{`try(fn() { return 5; 6 }, fn(err) { 0 })`, "5"},
+		{`try(fn() { 1 + true }, fn(err) { err["oops"] + 1 })`, "ERROR: type mismatch: NULL + INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := test_eval(tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			l_test.Errorf("%s: expected=%s, got=%v", tt.input, tt.expected, evaluated)
+		}
+	}
+
+	program := parser.New(lexer.New("try(fn() { let loop = fn() { loop() }; loop() }, fn(err) { 0 })")).ParseProgram()
+	evaluated := EvalContext(context.Background(), program, object.NewEnvironment(), Options{MaxSteps: 1000})
+	if err, ok := evaluated.(*object.Error); !ok || err.Kind != object.STEP_LIMIT_ERROR {
+		l_test.Errorf("expected the step limit not to be caught, got=%v", evaluated)
+	}
+}
+
+func TestFileSystemBuiltins(l_test *testing.T) {
+	root := l_test.TempDir()
+	outside := l_test.TempDir()
+	os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644)
+	os.Symlink(outside, filepath.Join(root, "escape"))
+	os.Mkdir(filepath.Join(root, "links"), 0755)
+	os.Symlink(filepath.Join(outside, "planted.txt"), filepath.Join(root, "links", "dangling"))
+	os.Symlink("../../"+filepath.Base(outside)+"/planted.txt", filepath.Join(root, "links", "relative"))
+	os.Symlink(filepath.Join(root, "inner.txt"), filepath.Join(root, "links", "inner"))
+
+	run := func(access object.FileAccess, input string) object.Object {
+		l_evaluator := New()
+		l_evaluator.Files = access
+		program := parser.New(lexer.New(input)).ParseProgram()
+		return l_evaluator.Eval(program, object.NewEnvironment())
+	}
+
+	access := object.FileAccess{Roots: []string{root}}
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`write_file("notes.txt", "hello"); read_file("notes.txt")`, "hello"},
+		{`write_file("` + filepath.Join(root, "a.txt") + `", "a"); list_dir(".")`, "[a.txt, escape, links, notes.txt]"},
+		{`exists("missing.txt")`, "false"},
+		{`write_file("gone.txt", ""); remove("gone.txt"); exists("gone.txt")`, "false"},
+		{`read_file("missing.txt")`, "ERROR: read_file: open " + filepath.Join(root, "missing.txt") + ": no such file or directory"},
+		{`read_file("` + filepath.Join(outside, "secret.txt") + `")`, "ERROR: access denied: " + filepath.Join(outside, "secret.txt") + " is outside the allowed directories"},
+		{`read_file("../secret.txt")`, "ERROR: access denied: ../secret.txt is outside the allowed directories"},
+		{`read_file("escape/secret.txt")`, "ERROR: access denied: escape/secret.txt is outside the allowed directories"},
+		{`remove(".")`, "ERROR: access denied: . is an allowed directory itself"},
+		{`write_file("links/dangling", "pwned")`, "ERROR: access denied: links/dangling is outside the allowed directories"},
+		{`write_file("links/relative", "pwned")`, "ERROR: access denied: links/relative is outside the allowed directories"},
+		{`write_file("links/inner", "inside"); read_file("inner.txt")`, "inside"},
+	}
+	for _, tt := range tests {
+		evaluated := run(access, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			l_test.Errorf("%s: expected=%s, got=%v", tt.input, tt.expected, evaluated)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(outside, "planted.txt")); err == nil {
+		l_test.Errorf("expected a dangling link not to lead a write outside the allowed directories")
+	}
+
+	read_only := object.FileAccess{Roots: []string{root}, ReadOnly: true}
+	if evaluated := run(read_only, `read_file("notes.txt")`); evaluated.Inspect() != "hello" {
+		l_test.Errorf("expected read-only access to read, got=%v", evaluated)
+	}
+	if err, ok := run(read_only, `write_file("notes.txt", "")`).(*object.Error); !ok || err.Kind != object.PERMISSION_ERROR {
+		l_test.Errorf("expected read-only access not to write, got=%v", err)
+	}
+	if err, ok := run(object.FileAccess{}, `exists("notes.txt")`).(*object.Error); !ok || err.Message != "access denied: notes.txt, scripts have no filesystem access" {
+		l_test.Errorf("expected no access by default, got=%v", err)
+	}
+}
+
+func TestRegexBuiltins(l_test *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`regex("a+b")`, `regex("a+b")`},
+		{`match(regex("(\\w+)@(\\w+)\\.com"), "mail tj@monna.com now")`, "[tj@monna.com, tj, monna]"},
+		{`match("a(x)?b", "ab")`, "[ab, null]"},
+		{`match("z", "abc")`, "null"},
+		{`captures("(?P<year>\\d{4})-(?P<month>\\d{2})", "on 2024-05-01")`, "{month: 05, year: 2024}"},
+		{`captures("(?P<year>\\d{4})", "no date")`, "null"},
+		{`find_all("\\d+", "1 apple, 22 pears, 333 plums")`, "[1, 22, 333]"},
+		{`find_all("\\d+", "none")`, "[]"},
+		{`replace_all("(\\w+)@(\\w+)", "tj@monna", "$2 at $1")`, "monna at tj"},
+		{`replace_all("\\d+", "1 and 22", fn(m) { repeat("#", len(m[0])) })`, "# and ##"},
+		{`replace_all("\\w+", "a b", upper)`, "argument 1 to `upper` must be STRING, got ARRAY"},
+		{`replace_all("\\w+", "a b", fn(m) { 1 })`, "replace_all function must return STRING, got INTEGER"},
+		{`regex("(")`, "invalid regex: error parsing regexp: missing closing ): `(`"},
+		{`match(1, "a")`, "argument 1 to `match` must be REGEX or STRING, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := test_eval(tt.input)
+		if err, ok := evaluated.(*object.Error); ok {
+			if err.Message != tt.expected {
+				l_test.Errorf("%s: expected=%q, got error %q", tt.input, tt.expected, err.Message)
+			}
+			continue
+		}
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			l_test.Errorf("%s: expected=%q, got=%v", tt.input, tt.expected, evaluated)
+		}
+	}
+
+	first := test_eval(`regex("x+")`).(*object.Regex)
+	second := test_eval(`regex("x+")`).(*object.Regex)
+	if first.Value != second.Value {
+		l_test.Errorf("expected the compiled pattern to be cached")
+	}
+}
+
+func TestTimeBuiltins(l_test *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"now()", "1714566600000"},
+		{"unix()", "1714566600"},
+		{"let before = now(); sleep(1500); now() - before", "1500"},
+		{"format_time(now())", "2024-05-01T12:30:00Z"},
+		{`format_time(now() + duration("36h"), "Mon 2 Jan 2006 15:04")`, "Fri 3 May 2024 00:30"},
+		{`format_time(now(), "15:04 MST", "America/New_York")`, "08:30 EDT"},
+		{`parse_time("2024-05-01T12:30:00Z") == now()`, "true"},
+		{`parse_time("2024-05-01", "2006-01-02")`, "1714521600000"},
+		{`format_duration(parse_time("2024-05-02", "2006-01-02") - now())`, "11h30m0s"},
+		{`duration("1m30s") * 2`, "180000"},
+		{`parse_time("yesterday")`, `parse_time: parsing time "yesterday" as "2006-01-02T15:04:05Z07:00": cannot parse "yesterday" as "2006"`},
+		{`duration("soon")`, `duration: time: invalid duration "soon"`},
+		{`format_time(0, "2006", "Mars/Olympus")`, "unknown time zone: Mars/Olympus"},
+	}
+
+	for _, tt := range tests {
+		l_evaluator := New()
+		l_evaluator.Clock = &fake_clock{now: start}
+		evaluated := l_evaluator.Eval(parser.New(lexer.New(tt.input)).ParseProgram(), object.NewEnvironment())
+
+		if err, ok := evaluated.(*object.Error); ok {
+			if err.Message != tt.expected {
+				l_test.Errorf("%s: expected=%q, got error %q", tt.input, tt.expected, err.Message)
+			}
+			continue
+		}
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			l_test.Errorf("%s: expected=%q, got=%v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestSleepIsCancelled(l_test *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	began := time.Now()
+	program := parser.New(lexer.New("sleep(60000); 1")).ParseProgram()
+	evaluated := New().EvalContext(ctx, program, object.NewEnvironment(), Options{})
+
+	if err, ok := evaluated.(*object.Error); !ok || err.Kind != object.CANCELLED_ERROR {
+		l_test.Errorf("expected a cancelled error, got=%v", evaluated)
+	}
+	if elapsed := time.Since(began); elapsed > 5*time.Second {
+		l_test.Errorf("sleep did not stop when cancelled, took %s", elapsed)
+	}
+}
+
+func TestMemberAccess(l_test *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let person = {"name": "Ada", "age": 36}; person.name`, "Ada"},
+		{`let person = {"name": "Ada"}; person.email`, "null"},
+		{`let config = {"db": {"host": "localhost"}}; config.db.host`, "localhost"},
+		{`let counter = {"keys": 3}; counter.keys`, "3"},
+		{`{"b": 2, "a": 1}.keys()`, "[a, b]"},
+		{`{"b": 2, "a": 1}.values()`, "[1, 2]"},
+		{`{"a": 1}.has("a")`, "true"},
+		{`{"a": 1}.len()`, "1"},
+		{`"abc".upper()`, "ABC"},
+		{`"a,b,c".split(",").join("-")`, "a-b-c"},
+		{`"  padded ".trim().len()`, "6"},
+		{`"%s is %d".format("x", 1)`, "x is 1"},
+		{`let arr = [1, 2]; let pushed = arr.push(3, 4); [arr, pushed]`, "[[1, 2], [1, 2, 3, 4]]"},
+		{`[3, 1, 2].sort().map(fn(x) { x * 10 })`, "[10, 20, 30]"},
+		{`[1, 2, 3].filter(fn(x) { x > 1 }).reduce(fn(a, b) { a + b })`, "5"},
+		{`[1, 2, 3].first() + [1, 2, 3].last()`, "4"},
+		{`[1, 2, 3].rest()`, "[2, 3]"},
+		{`[].first()`, "null"},
+		{`-3.abs()`, "-3"},
+		{`(-3).abs()`, "3"},
+		{`2.7.floor()`, "2"},
+		{`regex("\\d+").find_all("1 and 22")`, "[1, 22]"},
+		{`let upper = "abc".upper; upper()`, "ABC"},
+		{`"abc".upper`, "method upper of STRING"},
+		{`let shout = fn(s) { s.upper() }; shout("hey")`, "HEY"},
+		{`"abc".upper(1)`, "ERROR: wrong number of arguments, got=1, want=0"},
+		{`"abc".repeat("x")`, "ERROR: argument 1 to `repeat` must be INTEGER, got STRING"},
+		{`"abc".push(1)`, "ERROR: STRING has no method push"},
+		{`true.name`, "ERROR: BOOLEAN has no method name"},
+	}
+	for _, tt := range tests {
+		evaluated := test_eval(tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			l_test.Errorf("%s: expected=%s, got=%v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestStructs(l_test *testing.T) {
+	point := "struct Point { x, y }; let p = Point(1, 2); "
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"p", "Point{x: 1, y: 2}"},
+		{"Point", "struct Point { x, y }"},
+		{"p.x + p.y", "3"},
+		{`p.with("x", 10)`, "Point{x: 10, y: 2}"},
+		{`let q = p.with("y", [3]); p.y`, "2"},
+		{"p == Point(1, 2)", "true"},
+		{"p == Point(1.0, 2)", "true"},
+		{"p != Point(2, 1)", "true"},
+		{"struct Other { x, y }; p == Other(1, 2)", "false"},
+		{"p == [1, 2]", "false"},
+		{"Point([1], {\"a\": [2]}) == Point([1], {\"a\": [2]})", "true"},
+		{"Point([1], {\"a\": [2]}) == Point([1], {\"a\": [3]})", "false"},
+		{"Point([1, 2], 0) == Point([1], 0)", "false"},
+		{"[1, [2.0]] == [1, [2]]", "true"},
+		{"{\"a\": 1} == {\"a\": 1, \"b\": 2}", "false"},
+		{"{\"a\": 1, \"b\": 2} != {\"b\": 2, \"a\": 1}", "false"},
+		{"struct Line { from, to }; Line(p, Point(3, 4)) == Line(Point(1, 2), Point(3, 4))", "true"},
+		{"map([[1, 2], [3, 4]], fn(pair) { Point(pair[0], pair[1]) })", "[Point{x: 1, y: 2}, Point{x: 3, y: 4}]"},
+		{"struct Empty {}; Empty()", "Empty{}"},
+		{"let f = fn(n) { struct Counter { n }; Counter(n) }; f(3).n", "3"},
+		{"p.z", "ERROR: Point has no field z"},
+		{`p.with("z", 1)`, "ERROR: Point has no field z"},
+		{"Point(1)", "ERROR: wrong number of fields for Point, got=1, want=2"},
+		{"p + p", "ERROR: unknown operator: STRUCT + STRUCT"},
+	}
+
+	for _, tt := range tests {
+		input := point + tt.input
+		for _, evaluated := range []object.Object{test_eval(input), test_eval_resolved(l_test, input)} {
+			if evaluated == nil || evaluated.Inspect() != tt.expected {
+				l_test.Errorf("%s: expected=%s, got=%v", tt.input, tt.expected, evaluated)
+			}
+		}
+	}
+}
+
+func TestConditionalAndNullSafeExpressions(l_test *testing.T) {
+	person := `let person = {"name": "Ada", "address": {"city": "London"}, "tags": []}; `
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"true ? 1 : 2", "1"},
+		{"0 > 1 ? 1 : 2", "2"},
+		{"let sign = fn(n) { n < 0 ? -1 : n == 0 ? 0 : 1 }; [sign(-5), sign(0), sign(5)]", "[-1, 0, 1]"},
+		{"true ? 1 : [1 / 0]", "1"},
+		{"false ? 1 / 0 : 2", "2"},
+		{"person.age ?? 36", "36"},
+		{"person.name ?? \"nobody\"", "Ada"},
+		{"[1, 2][5] ?? [1, 2][1]", "2"},
+		{"false ?? true", "false"},
+		{"0 ?? 1", "0"},
+		{"person.name ?? 1 / 0", "Ada"},
+		{"person.address?.city", "London"},
+		{"person.company?.name", "null"},
+		{"person.company?.name ?? \"none\"", "none"},
+		{"person.company?.name?.upper()", "null"},
+		{"person.name?.upper()", "ADA"},
+		{"person.company?.missing(1 / 0)", "null"},
+		{"person.tags.first()?.len() ?? 0", "0"},
+		{"person.company?.name.upper()", "null"},
+		{"person.company?.address.city.len()", "null"},
+		{"person.company?.tags[1 / 0].len()", "null"},
+		{"let h = {}; h.a?.b.c", "null"},
+		{"person.address?.city.upper()", "LONDON"},
+		{"let r = fn(n) { n == 0 ? \"done\" : r(n - 1) }; r(3)", "done"},
+		{"person.company.name", "ERROR: NULL has no method name"},
+		{"person.name?.missing", "ERROR: STRING has no method missing"},
+		{"(1 / 0) ?? 1", "ERROR: division by zero"},
+		{"1 / 0 ? 1 : 2", "ERROR: division by zero"},
+	}
+
+	for _, tt := range tests {
+		input := person + tt.input
+		for _, evaluated := range []object.Object{test_eval(input), test_eval_resolved(l_test, input)} {
+			if evaluated == nil || evaluated.Inspect() != tt.expected {
+				l_test.Errorf("%s: expected=%s, got=%v", tt.input, tt.expected, evaluated)
+			}
+		}
+	}
+
+	// The branches of ?: and the right side of ?? are in tail position.
+	input := `let count = fn(n, total) { n == 0 ? total : count(n - 1, total + 1) };
+	let down = fn(n) { n == 0 ? "done" : [][0] ?? down(n - 1) };
+	[count(5000, 0), down(5000)]`
+	program := parser.New(lexer.New(input)).ParseProgram()
+	evaluated := EvalContext(context.Background(), program, object.NewEnvironment(), Options{MaxDepth: 10})
+	if evaluated.Inspect() != "[5000, done]" {
+		l_test.Errorf("expected [5000, done], got=%v", evaluated)
+	}
+}
+
+func TestEnums(l_test *testing.T) {
+	enums := `enum Result { Ok(value), Err(error) };
+	enum Status { Pending, Done(result, at), Failed(err) };
+	struct Point { x, y };
+	let describe = fn(status) {
+		match (status) {
+			Status.Pending => "pending",
+			Done(Result.Ok(v), _) => "done with " + format("%v", v),
+			Done(Err(e), at) => e + " at " + format("%v", at),
+			Status.Failed => "failed",
+		}
+	};
+	`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Result", "enum Result { Ok(value), Err(error) }"},
+		{"Result.Ok", "Result.Ok"},
+		{"Result.Ok(5)", "Ok(5)"},
+		{"Status.Pending", "Pending"},
+		{`Status.Done(Result.Ok([1]), 3)`, "Done(Ok([1]), 3)"},
+		{"Result.Ok(5).value", "5"},
+		{`Status.Done(1, 2).at`, "2"},
+		{"Result.Ok(5) == Result.Ok(5.0)", "true"},
+		{"Result.Ok(5) == Result.Err(5)", "false"},
+		{"Result.Ok([1, {\"a\": 2}]) == Result.Ok([1, {\"a\": 2}])", "true"},
+		{"Status.Pending == Status.Pending", "true"},
+		{"Status.Pending != Status.Failed(1)", "true"},
+		{"enum Other { Ok(value) }; Result.Ok(1) == Other.Ok(1)", "false"},
+		{"Result.Ok(5) is Result.Ok", "true"},
+		{"Result.Ok(5) is Result.Err", "false"},
+		{"Result.Err(5) is Result", "true"},
+		{"Status.Pending is Result", "false"},
+		{"Status.Pending is Status.Pending", "true"},
+		{"5 is Result", "false"},
+		{"Point(1, 2) is Point", "true"},
+		{"Result.Ok(1) is Point", "false"},
+		{"describe(Status.Pending)", "pending"},
+		{"describe(Status.Done(Result.Ok(42), 1))", "done with 42"},
+		{`describe(Status.Done(Result.Err("timeout"), 7))`, "timeout at 7"},
+		{"describe(Status.Failed(0))", "failed"},
+		{"map([Result.Ok(1), Result.Err(2)], fn(r) { r is Result.Ok })", "[true, false]"},
+		{"Result.Nope", "ERROR: enum Result has no variant Nope"},
+		{"Result.Ok(1).error", "ERROR: Result.Ok has no field error"},
+		{"Result.Ok(1, 2)", "ERROR: wrong number of values for Result.Ok, got=2, want=1"},
+		{"Result.Ok(5) is 5", "ERROR: is needs a struct, an enum or a variant on its right, got 5"},
+		{"Result.Ok(5) is Result.Ok(5)", "ERROR: is needs a struct, an enum or a variant on its right, got Ok(5)"},
+		{"describe(Result.Ok(1))", "ERROR: no match arm matches Ok(1)"},
+		{"let [Ok(v)] = [Result.Err(3)]; v", "ERROR: cannot destructure [Err(3)]: expected Ok(v), got Err(3)"},
+		{"let [Ok(v, w)] = [Result.Ok(3)]; v", "ERROR: cannot destructure [Ok(3)]: expected Ok with 2 values, got 1"},
+		{"let make = fn() { enum E { X }; E }; let first = make(); let second = make(); match (second.X) { first.X => 1, second.X => 2 }", "2"},
+		{"match (Result.Ok(1)) { Result.Okay(v) => v }", "ERROR: enum Result has no variant Okay"},
+		{"let n = 1; match (1) { n.Ok => 1 }", "ERROR: n in a pattern is not an enum, got INTEGER"},
+		{"let [Result.Err(e)] = [Result.Err(3)]; e", "3"},
+	}
+
+	for _, tt := range tests {
+		input := enums + tt.input
+		for _, evaluated := range []object.Object{test_eval(input), test_eval_resolved(l_test, input)} {
+			if evaluated == nil || evaluated.Inspect() != tt.expected {
+				l_test.Errorf("%s: expected=%s, got=%v", tt.input, tt.expected, evaluated)
+			}
+		}
+	}
+
+	unknown := test_eval(enums + "match (Result.Ok(1)) { Reslt.Ok(v) => v }")
+	if err, ok := unknown.(*object.Error); !ok || err.Message != "identifier not found: Reslt" {
+		l_test.Errorf("expected a pattern naming an unknown enum to be an error, got=%v", unknown)
+	}
+}
+
+func TestMatchExpressions(l_test *testing.T) {
+	describe := `let describe = fn(value) {
+		match (value) {
+			0 => "zero",
+			-1 => "minus one",
+			1.5 => "one and a half",
+			"hi" => "a greeting",
+			true => "yes",
+			[] => "empty",
+			[x] => "one element: " + format("%v", x),
+			[first, ...rest] if first == "head" => "head and " + format("%v", len(rest)),
+			[_, _, ...] => "two or more",
+			{name, "age": age} if age >= 18 => name + " is an adult",
+			{name} => name,
+			n if n == 1000 => "big",
+			_ => "something else",
+		}
+	};`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`describe(0)`, "zero"},
+		{`describe(0.0)`, "zero"},
+		{`describe(-1)`, "minus one"},
+		{`describe(1.5)`, "one and a half"},
+		{`describe("hi")`, "a greeting"},
+		{`describe(true)`, "yes"},
+		{`describe([])`, "empty"},
+		{`describe([7])`, "one element: 7"},
+		{`describe(["head", 1, 2])`, "head and 2"},
+		{`describe([1, 2, 3])`, "two or more"},
+		{`describe({"name": "Ada", "age": 36})`, "Ada is an adult"},
+		{`describe({"name": "Tim", "age": 9})`, "Tim"},
+		{`describe(1000)`, "big"},
+		{`describe(false)`, "something else"},
+	}
+	for _, tt := range tests {
+		for _, evaluated := range []object.Object{test_eval(describe + tt.input), test_eval_resolved(l_test, describe+tt.input)} {
+			if evaluated == nil || evaluated.Inspect() != tt.expected {
+				l_test.Errorf("%s: expected=%s, got=%v", tt.input, tt.expected, evaluated)
+			}
+		}
+	}
+
+	others := []struct {
+		input    string
+		expected string
+	}{
+		{`match (5) { 1 => "one" }`, "ERROR: no match arm matches 5"},
+		{`match (5) { x if x > 10 => "big" }`, "ERROR: no match arm matches 5"},
+		{`match ([1, [2, 3]]) { [a, [b, c]] => a + b + c }`, "6"},
+		{`match ({"point": {"x": 1, "y": 2}}) { {point: {x, y}} => x * 10 + y }`, "12"},
+		{`match (1) { _ if missing => 1 }`, "ERROR: identifier not found: missing"},
+		{`match("a(b)", "ab")`, "[ab, b]"},
+		{`let matched = match("b", "abc"); matched`, "[b]"},
+	}
+	for _, tt := range others {
+		evaluated := test_eval(tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			l_test.Errorf("%s: expected=%s, got=%v", tt.input, tt.expected, evaluated)
+		}
+	}
+
+	// What an arm binds stays in the arm, the names around the match keep their values and an arm that
+	// matched but whose guard was false leaves nothing bound.
+	scoped := []struct {
+		input    string
+		expected string
+	}{
+		{`let x = 1; match ([2]) { [x] => x }; x`, "1"},
+		{`let x = 1; let f = fn() { match ([2]) { [x] if x > 5 => x, _ => 0 }; x }; f()`, "1"},
+		{`let f = fn(list) { match (list) { [a] => fn() { a * 10 } } }; f([4])()`, "40"},
+		{`let f = fn(n) { match (n) { m if m > 0 => if (true) { let double = m * 2; double } } }; f(3)`, "6"},
+	}
+	for _, tt := range scoped {
+		for _, evaluated := range []object.Object{test_eval(tt.input), test_eval_resolved(l_test, tt.input)} {
+			if evaluated == nil || evaluated.Inspect() != tt.expected {
+				l_test.Errorf("%s: expected=%s, got=%v", tt.input, tt.expected, evaluated)
+			}
+		}
+	}
+	leaked := test_eval(`match ([1]) { [a] if false => a, _ => 0 }; a`)
+	if err, ok := leaked.(*object.Error); !ok || err.Message != "identifier not found: a" {
+		l_test.Errorf("expected the bindings of a failed arm to be gone, got=%v", leaked)
+	}
+
+	// The arms of a match are in tail position.
+	input := `let sum = fn(list, total) { match (list) { [] => total, [x, ...rest] => sum(rest, total + x) } }; sum(range(500), 0)`
+	program := parser.New(lexer.New(input)).ParseProgram()
+	evaluated := EvalContext(context.Background(), program, object.NewEnvironment(), Options{MaxDepth: 10})
+	test_integer_object(l_test, evaluated, 124750)
+}
+
+func TestModules(l_test *testing.T) {
+	root := l_test.TempDir()
+	vendor := l_test.TempDir()
+	outside := l_test.TempDir()
+	files := map[string]string{
+		filepath.Join(root, "geometry.mn"):      `puts("loading geometry"); let unit = 1; export let area = fn(w, h) { w * h * unit }; export let sides = 4;`,
+		filepath.Join(root, "shapes/square.mn"): `import "../geometry.mn" as geometry; export let area = fn(side) { geometry.area(side, side) };`,
+		filepath.Join(vendor, "strings.mn"):     `export let shout = fn(s) { upper(s) + "!" };`,
+		filepath.Join(root, "a.mn"):             `import "b.mn" as b; export let a = 1;`,
+		filepath.Join(root, "pair.mn"):          `export let [left, right] = [1, 2]; export struct Pair { left, right } export enum Side { Left, Right } export fn swap(p) { [p[1], p[0]] }`,
+		filepath.Join(root, "b.mn"):             `import "a.mn" as a; export let b = 2;`,
+		filepath.Join(root, "variant.mn"):       `enum R { Ok(value) }; export let [R.Ok(z), Ok({w})] = [R.Ok(7), R.Ok({"w": 8})];`,
+		filepath.Join(root, "broken.mn"):        `export let x = missing;`,
+		filepath.Join(root, "nested.mn"):        `let f = fn() { export let y = 1; };`,
+		filepath.Join(root, "failing.mn"):       `export let x = 1 / 0;`,
+		filepath.Join(outside, "secret.mn"):     `export let secret = 42;`,
+	}
+	for path, source := range files {
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(source), 0644)
+	}
+
+	run := func(search_paths []string, input string) (object.Object, string) {
+		var out bytes.Buffer
+		l_evaluator := New()
+		l_evaluator.Stdout = &out
+		l_evaluator.Modules.SearchPaths = search_paths
+
+		program := parser.New(lexer.New(input)).ParseProgram()
+		l_resolver := resolver.New(l_evaluator.Builtins.Has)
+		l_resolver.Resolve(program)
+		if len(l_resolver.Errors()) != 0 {
+			l_test.Fatalf("resolver has errors: %v", l_resolver.Errors())
+		}
+		return l_evaluator.Eval(program, object.NewEnvironment()), out.String()
+	}
+
+	search_paths := []string{root, vendor}
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "geometry.mn" as geometry; geometry.area(2, 3)`, "6"},
+		{`import "geometry.mn" as g; g`, `module("geometry.mn")`},
+		{`import "./shapes/square.mn" as square; square.area(3)`, "9"},
+		{`import "strings.mn" as strings; strings.shout("hi")`, "HI!"},
+		{`let f = fn() { import "geometry.mn" as geometry; geometry.sides }; f()`, "4"},
+		{`import "geometry.mn" as geometry; geometry.unit`, "ERROR: module geometry.mn does not export unit"},
+		{`let x = 1; x.y`, "ERROR: INTEGER has no method y"},
+		{`import "pair.mn" as pair; pair.left + pair.right`, "3"},
+		{`import "pair.mn" as pair; pair.Pair(1, 2)`, "Pair{left: 1, right: 2}"},
+		{`import "pair.mn" as pair; pair.Side.Left is pair.Side`, "true"},
+		{`import "pair.mn" as pair; pair.swap([pair.left, pair.right])`, "[2, 1]"},
+		{`import "variant.mn" as variant; variant.z + variant.w`, "15"},
+		{`import "missing.mn" as missing;`, `ERROR: module not found: "missing.mn"`},
+		{`import "a.mn" as a;`, "ERROR: in module a.mn: in module b.mn: import cycle: a.mn -> b.mn -> a.mn"},
+		{`import "broken.mn" as broken;`, "ERROR: in module broken.mn: identifier not found: missing"},
+		{`import "nested.mn" as nested;`, "ERROR: in module nested.mn: export is only allowed at the top level of a module"},
+		{`import "failing.mn" as failing;`, "ERROR: in module failing.mn: division by zero"},
+		{`import "` + filepath.Join(outside, "secret.mn") + `" as secret;`, "ERROR: access denied: " + filepath.Join(outside, "secret.mn") + " is outside the allowed directories"},
+	}
+	for _, tt := range tests {
+		evaluated, _ := run(search_paths, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			l_test.Errorf("%s: expected=%s, got=%v", tt.input, tt.expected, evaluated)
+		}
+	}
+
+	// geometry.mn is imported three times but only evaluated once.
+	evaluated, out := run(search_paths, `import "geometry.mn" as g; import "shapes/square.mn" as square; import "geometry.mn" as again; square.area(2) + again.sides`)
+	if evaluated.Inspect() != "8" || out != "loading geometry\n" {
+		l_test.Errorf("expected geometry.mn to be evaluated once, got=%v, printed=%q", evaluated, out)
+	}
+
+	if evaluated, _ := run(nil, `import "geometry.mn" as geometry;`); evaluated.(*object.Error).Kind != object.PERMISSION_ERROR {
+		l_test.Errorf("expected no imports without search paths, got=%v", evaluated)
+	}
+}
+
+func TestResolvedEvaluation(l_test *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"let newAdder = fn(x) { fn(y) { x + y }; }; let addTwo = newAdder(2); addTwo(2);", 4},
+		{"let x = 10; let f = fn(x) { let y = x * 2; fn() { x + y } }; f(1)() + x;", 13},
+		{"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(10);", 55},
+		{"let f = fn() { g() }; let g = fn() { len(\"four\") }; f();", 4},
+		{"let f = fn(a) { if (a > 1) { let b = a * 10; } b + a }; f(2);", 22},
+	}
+
+	for _, tt := range tests {
+		test_integer_object(l_test, test_eval_resolved(l_test, tt.input), tt.expected)
+	}
+}
+
+func TestTailCalls(l_test *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let count = fn(n) { if (n == 0) { return 0; } count(n - 1) }; count(1000000);", 0},
+		{"let sum = fn(n, total) { if (n == 0) { total } else { sum(n - 1, total + n) } }; sum(100000, 0);", 5000050000},
+		{"let sum = fn(n, total) { if (n == 0) { return total; } return sum(n - 1, total + n); }; sum(100000, 0);", 5000050000},
+		{`
+   let is_even = fn(n) { if (n == 0) { true } else { is_odd(n - 1) } };
+   let is_odd = fn(n) { if (n == 0) { false } else { is_even(n - 1) } };
+   if (is_even(100000)) { 1 } else { 0 };
+  `, 1},
+		{"let add = fn(a, b) { a + b }; let f = fn(x) { add(x, 1) }; f(1) + f(2);", 5},
+	}
+
+	for _, tt := range tests {
+		test_integer_object(l_test, test_eval(tt.input), tt.expected)
+		test_integer_object(l_test, test_eval_resolved(l_test, tt.input), tt.expected)
+	}
+}
+
+func TestExecutionLimits(l_test *testing.T) {
+	expired, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	tests := []struct {
+		input         string
+		ctx           context.Context
+		options       Options
+		expected_kind object.ErrorKind
+	}{
+		{"let loop = fn() { loop() }; loop();", context.Background(), Options{MaxSteps: 10000}, object.STEP_LIMIT_ERROR},
+		{"let f = fn(n) { 1 + f(n + 1) }; f(0);", context.Background(), Options{MaxDepth: 100}, object.DEPTH_LIMIT_ERROR},
+		{"let f = fn(n) { f(n + 1) }; f(0);", context.Background(), Options{MaxAllocations: 1000}, object.ALLOCATION_LIMIT_ERROR},
+		{"let loop = fn() { loop() }; loop();", expired, Options{}, object.CANCELLED_ERROR},
+		{"5 + true;", context.Background(), Options{MaxSteps: 100}, object.RUNTIME_ERROR},
+		{`repeat("ab", 1000000);`, context.Background(), Options{MaxAllocations: 1000}, object.ALLOCATION_LIMIT_ERROR},
+		{`repeat("ab", 9223372036854775807);`, context.Background(), Options{}, object.RUNTIME_ERROR},
+		{"range(1000000);", context.Background(), Options{MaxAllocations: 1000}, object.ALLOCATION_LIMIT_ERROR},
+		{`json_encode(repeat("ab", 400));`, context.Background(), Options{MaxAllocations: 1000}, object.ALLOCATION_LIMIT_ERROR},
+		{"range(100000000);", expired, Options{}, object.CANCELLED_ERROR},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := EvalContext(tt.ctx, program, object.NewEnvironment(), tt.options)
+
+		error_object, ok := evaluated.(*object.Error)
+		if !ok {
+			l_test.Errorf("no error object returned for %q, got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if error_object.Kind != tt.expected_kind {
+			l_test.Errorf("wrong error kind for %q, expected=%s, got=%s (%s)", tt.input, tt.expected_kind, error_object.Kind, error_object.Message)
+		}
+	}
+}
+
+func TestMethodsCountAllocations(l_test *testing.T) {
+	count := func(input string) int64 {
+		l_evaluator := New()
+		l_evaluator.EvalContext(context.Background(), parser.New(lexer.New(input)).ParseProgram(), object.NewEnvironment(), Options{})
+		return l_evaluator.allocations
+	}
+
+	// The same values are created, but for the copy with makes.
+	looked_up := count(`struct P { x }; let p = P(1); p.with; "x"; 2;`)
+	called := count(`struct P { x }; let p = P(1); p.with("x", 2);`)
+	if called != looked_up+1 {
+		l_test.Errorf("expected with to count its copy, got=%d allocations, want=%d", called, looked_up+1)
+	}
+}
+
+func TestTailCallsDoNotCountTowardsDepth(l_test *testing.T) {
+	input := "let count = fn(n) { if (n == 0) { return 0; } count(n - 1) }; count(10000);"
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	evaluated := EvalContext(context.Background(), program, object.NewEnvironment(), Options{MaxDepth: 10})
+	test_integer_object(l_test, evaluated, 0)
+}
+
+func TestBuiltinRegistry(l_test *testing.T) {
+	l_evaluator := New()
+	l_evaluator.Builtins.Register(&object.Builtin{
+		Name:      "repeat",
+		Namespace: "text",
+		Params:    []object.ObjectType{object.STRING_OBJECT, object.INTEGER_OBJECT},
+		Optional:  1,
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			times := int64(2)
+			if len(args) == 2 {
+				times = args[1].(*object.Integer).Value
+			}
+			result := ""
+			for i := int64(0); i < times; i++ {
+				result += args[0].(*object.String).Value
+			}
+			return &object.String{Value: result}
+		},
+	})
+	l_evaluator.Builtins.Register(&object.Builtin{
+		Name:   "len",
+		Params: []object.ObjectType{object.ANY_OBJECT},
+		Fn:     func(call *object.CallContext, args ...object.Object) object.Object { return &object.Integer{Value: 42} },
+	})
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`repeat("ab")`, "abab"},
+		{`repeat("ab", 3)`, "ababab"},
+		{`repeat()`, "wrong number of arguments, got=0, want=1 to 2"},
+		{`repeat("a", 1, 2)`, "wrong number of arguments, got=3, want=1 to 2"},
+		{`repeat(1)`, "argument 1 to `repeat` must be STRING, got INTEGER"},
+		{`repeat("a", "b")`, "argument 2 to `repeat` must be INTEGER, got STRING"},
+		{`len("overridden")`, 42},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := l_evaluator.Eval(program, object.NewEnvironment())
+
+		switch expected := tt.expected.(type) {
+		case int:
+			test_integer_object(l_test, evaluated, int64(expected))
+		case string:
+			switch result := evaluated.(type) {
+			case *object.String:
+				if result.Value != expected {
+					l_test.Errorf("wrong result for %q, expected=%q, got=%q", tt.input, expected, result.Value)
+				}
+			case *object.Error:
+				if result.Message != expected {
+					l_test.Errorf("wrong error message, expected=%q, got=%q", expected, result.Message)
+				}
+			default:
+				l_test.Errorf("unexpected result for %q, got=%T (%+v)", tt.input, evaluated, evaluated)
+			}
+		}
+	}
+
+	// Other evaluators keep the default builtins
+	test_integer_object(l_test, test_eval(`len("four")`), 4)
+
+	if count := l_evaluator.Builtins.UnregisterNamespace("text"); count != 1 {
+		l_test.Errorf("expected 1 builtin removed from text, got=%d", count)
+	}
+	if !l_evaluator.Builtins.Unregister("len") || l_evaluator.Builtins.Unregister("len") {
+		l_test.Errorf("expected len to be removed exactly once")
+	}
+
+	program := parser.New(lexer.New(`repeat("ab")`)).ParseProgram()
+	evaluated := l_evaluator.Eval(program, object.NewEnvironment())
+	if error_object, ok := evaluated.(*object.Error); !ok || error_object.Message != "identifier not found: repeat" {
+		l_test.Errorf("expected repeat to be gone, got=%+v", evaluated)
+	}
+
+	l_evaluator.Builtins.Define("physics", "g", &object.Float{Value: 9.81})
+	program = parser.New(lexer.New("g * 2")).ParseProgram()
+	if evaluated := l_evaluator.Eval(program, object.NewEnvironment()); evaluated.Inspect() != "19.62" {
+		l_test.Errorf("expected the constant g, got=%v", evaluated)
+	}
+	if count := l_evaluator.Builtins.UnregisterNamespace("math"); count != len(math_builtins)+len(math_constants) {
+		l_test.Errorf("expected every math builtin and constant removed, got=%d", count)
+	}
+	if l_evaluator.Builtins.Has("math") || !l_evaluator.Builtins.Has("g") {
+		l_test.Errorf("expected math to be removed and g to be kept")
+	}
+	if _, ok := l_evaluator.Builtins.Method(object.FLOAT_OBJECT, "floor"); ok {
+		l_test.Errorf("expected the math methods to be removed with the namespace")
+	}
+
+	err := l_evaluator.Builtins.DefineMethod(object.STRING_OBJECT, &object.Builtin{
+		Name:   "shout",
+		Params: []object.ObjectType{object.STRING_OBJECT},
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			return &object.String{Value: args[0].(*object.String).Value + "!"}
+		},
+	})
+	if err != nil {
+		l_test.Fatalf("DefineMethod failed: %s", err)
+	}
+	program = parser.New(lexer.New(`"hey".shout()`)).ParseProgram()
+	if evaluated := l_evaluator.Eval(program, object.NewEnvironment()); evaluated.Inspect() != "hey!" {
+		l_test.Errorf("expected the shout method, got=%v", evaluated)
+	}
+	if l_evaluator.Builtins.Unregister("shout") {
+		l_test.Errorf("expected Unregister to leave the shout method alone")
+	}
+	if !l_evaluator.Builtins.UnregisterMethod(object.STRING_OBJECT, "shout") || l_evaluator.Builtins.UnregisterMethod(object.STRING_OBJECT, "shout") {
+		l_test.Errorf("expected the shout method to be removed exactly once")
+	}
+	if err := l_evaluator.Builtins.DefineMethod(object.STRING_OBJECT, &object.Builtin{Name: "now", Fn: time_builtins[0].Fn}); err == nil {
+		l_test.Errorf("expected a method without parameters to be refused")
+	}
+}
+
+func TestBuiltinCallContext(l_test *testing.T) {
+	var out bytes.Buffer
+	var seen *object.CallContext
+
+	l_evaluator := New()
+	l_evaluator.Stdout = &out
+	l_evaluator.Builtins.Register(&object.Builtin{
+		Name: "spy",
+		Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+			seen = call
+			return NULL
+		},
+	})
+
+	input := `puts("Hello", 5);
+let f = fn(x) { spy(); x };
+f(1);`
+	program := parser.New(lexer.New(input)).ParseProgram()
+	env := object.NewEnvironment()
+	l_evaluator.Eval(program, env)
+
+	if out.String() != "Hello\n5\n" {
+		l_test.Errorf("puts wrote to the wrong place, got=%q", out.String())
+	}
+
+	if seen == nil {
+		l_test.Fatalf("spy was not called")
+	}
+	if seen.Position.Line != 2 || seen.Position.Column != 20 {
+		l_test.Errorf("wrong call position, got=%s", seen.Position)
+	}
+	if x, ok := seen.Env.Get("x"); !ok || x.Inspect() != "1" {
+		l_test.Errorf("builtin did not get the environment of its caller")
+	}
+	if seen.Context == nil || seen.Stdout != &out {
+		l_test.Errorf("builtin did not get the evaluator's context and output")
+	}
+}
+
+func TestStandardStreams(l_test *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	l_evaluator := New()
+	l_evaluator.Stdout = &stdout
+	l_evaluator.Stderr = &stderr
+	l_evaluator.Stdin = strings.NewReader("first line\r\nsecond line\nthe rest\nof it")
+
+	input := `
+   let first = read_line();
+   print("1: ", first, "|");
+   puts(read_line());
+   eprint("oops", 2);
+   let rest = read_all();
+   print(rest);
+   if (!read_line()) { print("!") }
+  `
+	program := parser.New(lexer.New(input)).ParseProgram()
+	evaluated := l_evaluator.Eval(program, object.NewEnvironment())
+	if is_error(evaluated) {
+		l_test.Fatalf("evaluation failed: %s", evaluated.Inspect())
+	}
+
+	if stdout.String() != "1: first line|second line\nthe rest\nof it!" {
+		l_test.Errorf("wrong stdout, got=%q", stdout.String())
+	}
+	if stderr.String() != "oops\n2\n" {
+		l_test.Errorf("wrong stderr, got=%q", stderr.String())
+	}
+}
+
 // Helpers
+
+// A clock that only moves when a script sleeps.
+type fake_clock struct {
+	now time.Time
+}
+
+func (l_clock *fake_clock) Now() time.Time {
+	return l_clock.now
+}
+
+func (l_clock *fake_clock) Sleep(ctx context.Context, d time.Duration) error {
+	l_clock.now = l_clock.now.Add(d)
+	return nil
+}
+
+// An expected error message in tests whose other expected values are strings.
+type expected_error string
+
+func test_eval_resolved(l_test *testing.T, input string) object.Object {
+	l_parser := parser.New(lexer.New(input))
+	program := l_parser.ParseProgram()
+
+	l_resolver := resolver.New(NewRegistry().Has)
+	l_resolver.Resolve(program)
+	if len(l_resolver.Errors()) != 0 {
+		l_test.Fatalf("resolver has errors: %v", l_resolver.Errors())
+	}
+
+	return Eval(program, object.NewEnvironment())
+}
+
 func test_eval(input string) object.Object {
 	l_lexer := lexer.New(input)
 	l_parser := parser.New(l_lexer)
@@ -345,3 +1786,40 @@ func test_null_object(l_test *testing.T, object object.Object) bool {
 	}
 	return true
 }
+
+// Benchmarks
+//
+// Each workload is run twice, once straight from the parser where every identifier is looked up by name
+// through the chain of environments, and once after the resolver where locals are read from slots.
+var benchmarks = []struct {
+	name  string
+	input string
+}{
+	{"fibonacci", `
+   let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+   fib(20);
+  `},
+	{"loop", `
+   let sum = fn(i, n, total) { if (i > n) { total } else { sum(i + 1, n, total + i) } };
+   sum(0, 5000, 0);
+  `},
+}
+
+func BenchmarkEval(l_benchmark *testing.B) {
+	for _, bench := range benchmarks {
+		l_benchmark.Run(bench.name+"/dynamic", func(l_benchmark *testing.B) {
+			program := parser.New(lexer.New(bench.input)).ParseProgram()
+			for i := 0; i < l_benchmark.N; i++ {
+				Eval(program, object.NewEnvironment())
+			}
+		})
+
+		l_benchmark.Run(bench.name+"/resolved", func(l_benchmark *testing.B) {
+			program := parser.New(lexer.New(bench.input)).ParseProgram()
+			resolver.New(NewRegistry().Has).Resolve(program)
+			for i := 0; i < l_benchmark.N; i++ {
+				Eval(program, object.NewEnvironment())
+			}
+		})
+	}
+}
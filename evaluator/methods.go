@@ -0,0 +1,191 @@
+package evaluator
+
+import "monna/object"
+
+// The builtins every type gets as methods, called with the value as their first argument, so
+// "a,b".split(",") is split("a,b", ",") and [3, 1, 2].sort() is sort([3, 1, 2]).
+var builtin_methods = map[object.ObjectType][]string{
+	object.STRING_OBJECT:  {"len", "split", "trim", "upper", "lower", "replace", "contains", "starts_with", "ends_with", "index_of", "substr", "repeat", "format"},
+	object.ARRAY_OBJECT:   {"len", "join", "map", "filter", "reduce", "each", "sort", "zip", "find", "any", "all"},
+	object.HASH_OBJECT:    {"len"},
+	object.INTEGER_OBJECT: {"abs", "pow", "sqrt"},
+	object.FLOAT_OBJECT:   {"abs", "pow", "sqrt", "floor", "ceil", "round"},
+	object.REGEX_OBJECT:   {"match", "captures", "find_all", "replace_all"},
+}
+
+// Methods that aren't builtins as well. Like the collection builtins they leave the value they are called on
+// as it was.
+var type_methods = map[object.ObjectType][]*object.Builtin{
+	object.ARRAY_OBJECT: {
+		{
+			// push gives a new array with the elements appended.
+			Name:      "push",
+			Namespace: "collections",
+			Params:    []object.ObjectType{object.ARRAY_OBJECT, object.ANY_OBJECT},
+			Variadic:  true,
+			Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+				elements := args[0].(*object.Array).Elements
+				pushed := make([]object.Object, 0, len(elements)+len(args)-1)
+				pushed = append(pushed, elements...)
+				pushed = append(pushed, args[1:]...)
+				return &object.Array{Elements: pushed}
+			},
+		},
+		{
+			Name:      "first",
+			Namespace: "collections",
+			Params:    []object.ObjectType{object.ARRAY_OBJECT},
+			Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+				elements := args[0].(*object.Array).Elements
+				if len(elements) == 0 {
+					return NULL
+				}
+				return elements[0]
+			},
+		},
+		{
+			Name:      "last",
+			Namespace: "collections",
+			Params:    []object.ObjectType{object.ARRAY_OBJECT},
+			Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+				elements := args[0].(*object.Array).Elements
+				if len(elements) == 0 {
+					return NULL
+				}
+				return elements[len(elements)-1]
+			},
+		},
+		{
+			// rest gives every element but the first, it is null for an empty array.
+			Name:      "rest",
+			Namespace: "collections",
+			Params:    []object.ObjectType{object.ARRAY_OBJECT},
+			Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+				elements := args[0].(*object.Array).Elements
+				if len(elements) == 0 {
+					return NULL
+				}
+				return &object.Array{Elements: append([]object.Object{}, elements[1:]...)}
+			},
+		},
+	},
+	object.HASH_OBJECT: {
+		{
+			// keys and values come in the order of the keys, like a hash is printed.
+			Name:      "keys",
+			Namespace: "collections",
+			Params:    []object.ObjectType{object.HASH_OBJECT},
+			Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+				pairs := args[0].(*object.Hash).SortedPairs()
+				keys := make([]object.Object, len(pairs))
+				for i, pair := range pairs {
+					keys[i] = pair.Key
+				}
+				return &object.Array{Elements: keys}
+			},
+		},
+		{
+			Name:      "values",
+			Namespace: "collections",
+			Params:    []object.ObjectType{object.HASH_OBJECT},
+			Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+				pairs := args[0].(*object.Hash).SortedPairs()
+				values := make([]object.Object, len(pairs))
+				for i, pair := range pairs {
+					values[i] = pair.Value
+				}
+				return &object.Array{Elements: values}
+			},
+		},
+		{
+			Name:      "has",
+			Namespace: "collections",
+			Params:    []object.ObjectType{object.HASH_OBJECT, object.ANY_OBJECT},
+			Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+				key, ok := args[1].(object.Hashable)
+				if !ok {
+					return new_error("unusable as hash key: %s", args[1].Type())
+				}
+				_, ok = args[0].(*object.Hash).Pairs[key.HashKey()]
+				return native_bool_to_boolean_object(ok)
+			},
+		},
+	},
+	object.STRUCT_OBJECT: {
+		{
+			// with gives a copy of the instance with one field set to a new value.
+			Name:      "with",
+			Namespace: "structs",
+			Params:    []object.ObjectType{object.STRUCT_OBJECT, object.STRING_OBJECT, object.ANY_OBJECT},
+			Fn: func(call *object.CallContext, args ...object.Object) object.Object {
+				instance, field := args[0].(*object.StructInstance), args[1].(*object.String).Value
+				i, ok := instance.Struct.Field(field)
+				if !ok {
+					return new_error("%s has no field %s", instance.Struct.Name, field)
+				}
+				if err := call.Allocate(1); err != nil {
+					return err
+				}
+				values := append([]object.Object{}, instance.Values...)
+				values[i] = args[2]
+				return &object.StructInstance{Struct: instance.Struct, Values: values}
+			},
+		},
+	},
+}
+
+// Hash, struct and enum fields come before methods, so a hash with a "keys" key gives that rather than the
+// keys method. A field a hash doesn't have is null, like it is with an index expression, one a struct or
+// an enum value doesn't have is an error. The variants of an enum are read from it the same way.
+func (l_evaluator *Evaluator) eval_member_expression(left object.Object, name string) object.Object {
+	switch left := left.(type) {
+	case *object.Module:
+		value, ok := left.Exports[name]
+		if !ok {
+			return new_error("module %s does not export %s", left.Name, name)
+		}
+		return value
+
+	case *object.Hash:
+		key := &object.String{Value: name}
+		if pair, ok := left.Pairs[key.HashKey()]; ok {
+			return pair.Value
+		}
+
+	case *object.StructInstance:
+		if value, ok := left.Get(name); ok {
+			return value
+		}
+		if _, ok := l_evaluator.Builtins.Method(left.Type(), name); !ok {
+			return new_error("%s has no field %s", left.Struct.Name, name)
+		}
+
+	case *object.EnumType:
+		variant, ok := left.Variant(name)
+		if !ok {
+			return new_error("enum %s has no variant %s", left.Name, name)
+		}
+		if len(variant.Fields) == 0 {
+			l_evaluator.allocate()
+			return &object.EnumValue{Variant: variant}
+		}
+		return variant
+
+	case *object.EnumValue:
+		if value, ok := left.Get(name); ok {
+			return value
+		}
+		if _, ok := l_evaluator.Builtins.Method(left.Type(), name); !ok {
+			return new_error("%s has no field %s", left.Variant.Inspect(), name)
+		}
+	}
+
+	if method, ok := l_evaluator.Builtins.Method(left.Type(), name); ok {
+		l_evaluator.allocate()
+		return &object.BoundMethod{Receiver: left, Method: method}
+	}
+	if left.Type() == object.HASH_OBJECT {
+		return NULL
+	}
+	return new_error("%s has no method %s", left.Type(), name)
+}
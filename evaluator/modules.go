@@ -0,0 +1,167 @@
+package evaluator
+
+import (
+	"fmt"
+	"monna/ast"
+	"monna/lexer"
+	"monna/object"
+	"monna/parser"
+	"monna/resolver"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+/*
+   Modules
+
+   A script imports another file as a module and reads what that file exports through the name it was
+   bound to:
+
+   ```
+   // geometry.mn
+   export let area = fn(w, h) { w * h };
+
+   // main.mn
+   import "geometry.mn" as geometry;
+   geometry.area(2, 3);
+   ```
+
+   A module is evaluated in an environment of its own, the first time it is imported. Every later import of
+   the same file, from anywhere, gives back the module object that was built then. A module that ends up
+   importing itself, directly or through others, is an error naming the chain of imports.
+
+   Modules are read from the search paths the host gives the Loader and from nowhere else, so an embedded
+   interpreter can't import anything until the host says where from.
+*/
+
+// Loader finds, evaluates and caches the modules scripts import.
+type Loader struct {
+	// SearchPaths are the directories modules are imported from, searched in order.
+	SearchPaths []string
+
+	modules map[string]*object.Module // by the resolved path of their file
+	loading []loading                 // the modules being evaluated, the innermost last
+}
+
+type loading struct {
+	file string
+	name string // the path it was imported by
+}
+
+func NewLoader(search_paths ...string) *Loader {
+	return &Loader{SearchPaths: search_paths, modules: make(map[string]*object.Module)}
+}
+
+// Finds the file an import refers to. A path starting with ./ or ../ is relative to the module doing the
+// import, any other relative path is looked up in each search path in turn.
+func (l_loader *Loader) find(path string) (string, *object.Error) {
+	if len(l_loader.SearchPaths) == 0 {
+		return "", new_permission_error("cannot import %s, no module search paths are set", strconv.Quote(path))
+	}
+
+	candidates := []string{}
+	switch {
+	case filepath.IsAbs(path):
+		candidates = append(candidates, path)
+
+	case strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../"):
+		directory := l_loader.SearchPaths[0]
+		if len(l_loader.loading) > 0 {
+			directory = filepath.Dir(l_loader.loading[len(l_loader.loading)-1].file)
+		}
+		candidates = append(candidates, filepath.Join(directory, path))
+
+	default:
+		for _, search_path := range l_loader.SearchPaths {
+			candidates = append(candidates, filepath.Join(search_path, path))
+		}
+	}
+
+	access := object.FileAccess{Roots: l_loader.SearchPaths, ReadOnly: true}
+	for _, candidate := range candidates {
+		file, err := allowed_path(access, candidate, false)
+		if err != nil {
+			return "", err
+		}
+		if info, stat_err := os.Stat(file); stat_err == nil && !info.IsDir() {
+			return file, nil
+		}
+	}
+	return "", new_error("module not found: %s", strconv.Quote(path))
+}
+
+func (l_evaluator *Evaluator) import_module(path string) object.Object {
+	loader := l_evaluator.Modules
+
+	file, err := loader.find(path)
+	if err != nil {
+		return err
+	}
+	if module, ok := loader.modules[file]; ok {
+		return module
+	}
+	for i, importing := range loader.loading {
+		if importing.file == file {
+			chain := []string{}
+			for _, module := range loader.loading[i:] {
+				chain = append(chain, module.name)
+			}
+			return new_error("import cycle: %s -> %s", strings.Join(chain, " -> "), path)
+		}
+	}
+
+	source, read_err := os.ReadFile(file)
+	if read_err != nil {
+		return new_error("cannot import %s: %s", strconv.Quote(path), read_err)
+	}
+	l_parser := parser.New(lexer.New(string(source)))
+	program := l_parser.ParseProgram()
+	if errors := l_parser.Errors(); len(errors) > 0 {
+		return new_error("in module %s: %s", path, strings.Join(errors, "; "))
+	}
+	l_resolver := resolver.New(l_evaluator.Builtins.Has)
+	l_resolver.Resolve(program)
+	if errors := l_resolver.Errors(); len(errors) > 0 {
+		return new_error("in module %s: %s", path, strings.Join(errors, "; "))
+	}
+
+	env := object.NewEnvironment()
+	loader.loading = append(loader.loading, loading{file: file, name: path})
+	result := l_evaluator.eval(program, env)
+	loader.loading = loader.loading[:len(loader.loading)-1]
+	if err, ok := result.(*object.Error); ok {
+		return &object.Error{Kind: err.Kind, Message: fmt.Sprintf("in module %s: %s", path, err.Message)}
+	}
+
+	module := &object.Module{Name: path, Exports: make(map[string]object.Object)}
+	for _, statement := range program.Statements {
+		export, ok := statement.(*ast.ExportStatement)
+		if !ok {
+			continue
+		}
+		for _, name := range declared_names(export.Statement) {
+			if value, ok := env.Get(name); ok {
+				module.Exports[name] = value
+			}
+		}
+	}
+	loader.modules[file] = module
+	return module
+}
+
+// The names a declaration binds.
+func declared_names(statement ast.Statement) []string {
+	switch statement := statement.(type) {
+	case *ast.LetStatement:
+		return pattern_names(statement.Name, nil)
+	case *ast.StructStatement:
+		return []string{statement.Name.Value}
+	case *ast.EnumStatement:
+		return []string{statement.Name.Value}
+	case *ast.FunctionStatement:
+		return []string{statement.Name.Value}
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+package evaluator
+
+import (
+	"fmt"
+	"monna/ast"
+	"monna/object"
+)
+
+// A name a pattern binds and the value it is bound to.
+type binding struct {
+	name  *ast.Identifier
+	value object.Object
+}
+
+func (l_evaluator *Evaluator) eval_match_expression(node *ast.MatchExpression, env *object.Environment) object.Object {
+	subject := l_evaluator.eval(node.Subject, env)
+	if is_error(subject) {
+		return subject
+	}
+
+	for _, arm := range node.Arms {
+		bindings, mismatch, err := l_evaluator.match_pattern(arm.Pattern, subject, env, nil)
+		if err != nil {
+			return err
+		}
+		if mismatch != "" {
+			continue
+		}
+
+		// The arm binds into an environment of its own, so the names around the match keep their values
+		// and an arm whose guard is false leaves nothing behind.
+		l_evaluator.allocate()
+		arm_env := object.NewEnclosedEnvironment(env)
+		if arm.Resolved {
+			arm_env = object.NewSlotEnvironment(env, arm.Slots)
+		}
+		for _, binding := range bindings {
+			bind(binding.name, binding.value, arm_env)
+		}
+
+		if arm.Guard != nil {
+			guard := l_evaluator.eval(arm.Guard, arm_env)
+			if is_error(guard) {
+				return guard
+			}
+			if !is_truthy(guard) {
+				continue
+			}
+		}
+		return l_evaluator.eval(arm.Body, arm_env)
+	}
+	return new_error("no match arm matches %s", subject.Inspect())
+}
+
+// Matches a value against a pattern. When it matches the bindings the pattern makes are added to bindings,
+// when it doesn't the description of what didn't fit is returned. Nothing is bound before the whole pattern
+// has matched. The enums the pattern names are looked up in env, a pattern naming an enum or a variant that
+// doesn't exist is an error rather than a mismatch.
+func (l_evaluator *Evaluator) match_pattern(pattern ast.Pattern, value object.Object, env *object.Environment, bindings []binding) ([]binding, string, *object.Error) {
+	switch pattern := pattern.(type) {
+	case *ast.WildcardPattern:
+		return bindings, "", nil
+
+	case *ast.Identifier:
+		return append(bindings, binding{name: pattern, value: value}), "", nil
+
+	case *ast.LiteralPattern:
+		if !objects_equal(literal_value(pattern.Value), value) {
+			return nil, fmt.Sprintf("expected %s, got %s", pattern.Value.String(), value.Inspect()), nil
+		}
+		return bindings, "", nil
+
+	case *ast.ArrayPattern:
+		array, ok := value.(*object.Array)
+		if !ok {
+			return nil, fmt.Sprintf("expected an array, got %s", value.Type()), nil
+		}
+		elements := array.Elements
+		if pattern.Rest == nil && len(elements) != len(pattern.Elements) {
+			return nil, fmt.Sprintf("expected an array of %d elements, got %d", len(pattern.Elements), len(elements)), nil
+		}
+		if len(elements) < len(pattern.Elements) {
+			return nil, fmt.Sprintf("expected an array of at least %d elements, got %d", len(pattern.Elements), len(elements)), nil
+		}
+
+		for i, element := range pattern.Elements {
+			var mismatch string
+			var err *object.Error
+			if bindings, mismatch, err = l_evaluator.match_pattern(element, elements[i], env, bindings); err != nil || mismatch != "" {
+				return nil, mismatch, err
+			}
+		}
+		if pattern.Rest != nil {
+			rest := &object.Array{Elements: append([]object.Object{}, elements[len(pattern.Elements):]...)}
+			return l_evaluator.match_pattern(pattern.Rest, rest, env, bindings)
+		}
+		return bindings, "", nil
+
+	case *ast.HashPattern:
+		hash, ok := value.(*object.Hash)
+		if !ok {
+			return nil, fmt.Sprintf("expected a hash, got %s", value.Type()), nil
+		}
+		for _, pair := range pattern.Pairs {
+			key := &object.String{Value: pair.Key}
+			member, ok := hash.Pairs[key.HashKey()]
+			if !ok {
+				return nil, fmt.Sprintf("missing key %q", pair.Key), nil
+			}
+			var mismatch string
+			var err *object.Error
+			if bindings, mismatch, err = l_evaluator.match_pattern(pair.Value, member.Value, env, bindings); err != nil || mismatch != "" {
+				return nil, mismatch, err
+			}
+		}
+		return bindings, "", nil
+
+	case *ast.VariantPattern:
+		enum_value, ok := value.(*object.EnumValue)
+		if pattern.Enum != nil {
+			variant, err := l_evaluator.pattern_variant(pattern, env)
+			if err != nil {
+				return nil, "", err
+			}
+			ok = ok && enum_value.Variant == variant
+		} else {
+			ok = ok && enum_value.Variant.Name == pattern.Variant
+		}
+		if !ok {
+			return nil, fmt.Sprintf("expected %s, got %s", pattern.String(), value.Inspect()), nil
+		}
+		if pattern.Values == nil {
+			return bindings, "", nil
+		}
+		if len(pattern.Values) != len(enum_value.Values) {
+			return nil, fmt.Sprintf("expected %s with %d values, got %d", pattern.Variant, len(pattern.Values), len(enum_value.Values)), nil
+		}
+		for i, element := range pattern.Values {
+			var mismatch string
+			var err *object.Error
+			if bindings, mismatch, err = l_evaluator.match_pattern(element, enum_value.Values[i], env, bindings); err != nil || mismatch != "" {
+				return nil, mismatch, err
+			}
+		}
+		return bindings, "", nil
+	}
+
+	return nil, fmt.Sprintf("unknown pattern %s", pattern.String()), nil
+}
+
+// The variant a pattern like Result.Ok names, found through the enum the way Result.Ok is in an expression.
+func (l_evaluator *Evaluator) pattern_variant(pattern *ast.VariantPattern, env *object.Environment) (*object.Variant, *object.Error) {
+	value := l_evaluator.eval_identifier(pattern.Enum, env)
+	if err, ok := value.(*object.Error); ok {
+		return nil, err
+	}
+	enum, ok := value.(*object.EnumType)
+	if !ok {
+		return nil, new_error("%s in a pattern is not an enum, got %s", pattern.Enum.Value, value.Type())
+	}
+	variant, ok := enum.Variant(pattern.Variant)
+	if !ok {
+		return nil, new_error("enum %s has no variant %s", enum.Name, pattern.Variant)
+	}
+	return variant, nil
+}
+
+// The value of the literal in a literal pattern, which the parser only lets be a number, a negated number,
+// a string or a boolean.
+func literal_value(literal ast.Expression) object.Object {
+	switch literal := literal.(type) {
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: literal.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: literal.Value}
+	case *ast.StringLiteral:
+		return &object.String{Value: literal.Value}
+	case *ast.Boolean:
+		return native_bool_to_boolean_object(literal.Value)
+	case *ast.PrefixExpression:
+		switch value := literal_value(literal.Right).(type) {
+		case *object.Integer:
+			return &object.Integer{Value: -value.Value}
+		case *object.Float:
+			return &object.Float{Value: -value.Value}
+		}
+	}
+	return NULL
+}
+
+// Binds what a let statement declares. A pattern the value doesn't fit is an error, and binds nothing.
+func (l_evaluator *Evaluator) destructure(pattern ast.Pattern, value object.Object, env *object.Environment) *object.Error {
+	if name, ok := pattern.(*ast.Identifier); ok {
+		bind(name, value, env)
+		return nil
+	}
+
+	bindings, mismatch, err := l_evaluator.match_pattern(pattern, value, env, nil)
+	if err != nil {
+		return err
+	}
+	if mismatch != "" {
+		return new_error("cannot destructure %s: %s", value.Inspect(), mismatch)
+	}
+	for _, binding := range bindings {
+		bind(binding.name, binding.value, env)
+	}
+	return nil
+}
+
+// The names a pattern binds, in the order they appear.
+func pattern_names(pattern ast.Pattern, names []string) []string {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		names = append(names, pattern.Value)
+
+	case *ast.ArrayPattern:
+		for _, element := range pattern.Elements {
+			names = pattern_names(element, names)
+		}
+		if pattern.Rest != nil {
+			names = pattern_names(pattern.Rest, names)
+		}
+
+	case *ast.HashPattern:
+		for _, pair := range pattern.Pairs {
+			names = pattern_names(pair.Value, names)
+		}
+
+	case *ast.VariantPattern:
+		for _, value := range pattern.Values {
+			names = pattern_names(value, names)
+		}
+	}
+	return names
+}
+
+// Whether two values are equal the way == compares them. An integer is equal to the same float, arrays
+// are equal when their elements are and hashes when they have the same keys with equal values. Two
+// instances of a struct are equal when their fields are and two enum values when they are of the same
+// variant with equal values, so fields holding arrays or hashes are compared the same way.
+func objects_equal(left, right object.Object) bool {
+	switch {
+	case left.Type() == object.INTEGER_OBJECT && right.Type() == object.INTEGER_OBJECT:
+		return left.(*object.Integer).Value == right.(*object.Integer).Value
+	case is_number(left) && is_number(right):
+		return to_float(left) == to_float(right)
+	case left.Type() == object.STRING_OBJECT && right.Type() == object.STRING_OBJECT:
+		return left.(*object.String).Value == right.(*object.String).Value
+	case left.Type() == object.ARRAY_OBJECT && right.Type() == object.ARRAY_OBJECT:
+		return all_equal(left.(*object.Array).Elements, right.(*object.Array).Elements)
+	case left.Type() == object.HASH_OBJECT && right.Type() == object.HASH_OBJECT:
+		left, right := left.(*object.Hash), right.(*object.Hash)
+		if len(left.Pairs) != len(right.Pairs) {
+			return false
+		}
+		for key, pair := range left.Pairs {
+			other, ok := right.Pairs[key]
+			if !ok || !objects_equal(pair.Value, other.Value) {
+				return false
+			}
+		}
+		return true
+	case left.Type() == object.STRUCT_OBJECT && right.Type() == object.STRUCT_OBJECT:
+		left, right := left.(*object.StructInstance), right.(*object.StructInstance)
+		return left.Struct == right.Struct && all_equal(left.Values, right.Values)
+	case left.Type() == object.ENUM_VALUE_OBJECT && right.Type() == object.ENUM_VALUE_OBJECT:
+		left, right := left.(*object.EnumValue), right.(*object.EnumValue)
+		return left.Variant == right.Variant && all_equal(left.Values, right.Values)
+	default:
+		return left == right
+	}
+}
+
+// Whether two lists of values are as long as each other and equal position by position.
+func all_equal(left, right []object.Object) bool {
+	if len(left) != len(right) {
+		return false
+	}
+	for i := range left {
+		if !objects_equal(left[i], right[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Binds a name where the resolver said it lives, or by name when the program wasn't resolved.
+func bind(name *ast.Identifier, value object.Object, env *object.Environment) {
+	if name.Resolved {
+		env.SetAt(name.Slot, name.Value, value)
+	} else {
+		env.Set(name.Value, value)
+	}
+}
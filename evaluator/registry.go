@@ -0,0 +1,287 @@
+/*
+   Builtin Registry
+
+   Builtins used to be a package level map, so the only way to give scripts a new function was to edit
+   this package. Now every Evaluator has its own Registry, the host can add functions to it, replace the
+   default ones or take them away to sandbox a script, without affecting any other evaluator.
+
+   A builtin is called by its Name. Its Namespace is a label for a group of related builtins, so a whole
+   group can be taken out at once:
+
+   ```
+   registry.UnregisterNamespace("fs")
+   ```
+
+   Besides functions a registry holds constants, which are looked up the same way, and the methods of each
+   type, i.e. "abc".upper().
+
+   The builtins and constants of some namespaces aren't globals. Scripts read them from an object named
+   after the namespace, the way they read what a module exports, so `pi` and `min` are left for scripts
+   to name their own variables:
+
+   ```
+   math.round(math.pi * math.pow(2, 2));
+   ```
+*/
+
+package evaluator
+
+import (
+	"fmt"
+	"monna/object"
+	"sort"
+)
+
+// The builtins every new Registry starts out with, one group per file they are defined in.
+var default_builtins = [][]*object.Builtin{builtins, string_builtins, collection_builtins, math_builtins, json_builtins, fs_builtins, regex_builtins, time_builtins}
+
+// The namespaces read as an object of the same name rather than as globals.
+var module_namespaces = map[string]bool{"math": true}
+
+type Registry struct {
+	builtins  map[string]*object.Builtin
+	constants map[string]*constant
+	modules   map[string]*object.Module // by namespace
+	methods   object.MethodTable
+}
+
+type constant struct {
+	namespace string
+	value     object.Object
+}
+
+// NewRegistry creates a registry holding the default builtins.
+func NewRegistry() *Registry {
+	l_registry := &Registry{
+		builtins:  make(map[string]*object.Builtin),
+		constants: make(map[string]*constant),
+		modules:   make(map[string]*object.Module),
+		methods:   object.MethodTable{},
+	}
+	by_name := make(map[string]*object.Builtin)
+	for _, group := range default_builtins {
+		for _, builtin := range group {
+			l_registry.Register(builtin)
+			by_name[builtin.Name] = builtin
+		}
+	}
+	for name, value := range math_constants {
+		l_registry.Define("math", name, value)
+	}
+	for object_type, names := range builtin_methods {
+		for _, name := range names {
+			l_registry.DefineMethod(object_type, by_name[name])
+		}
+	}
+	for object_type, methods := range type_methods {
+		for _, method := range methods {
+			l_registry.DefineMethod(object_type, method)
+		}
+	}
+	return l_registry
+}
+
+// Register adds a builtin, replacing any builtin that already has the same name. A builtin in one of the
+// namespaces read as an object is added to that object instead.
+func (l_registry *Registry) Register(builtin *object.Builtin) error {
+	if err := validate_builtin(builtin); err != nil {
+		return err
+	}
+	if module, ok := l_registry.module(builtin.Namespace); ok {
+		module.Exports[builtin.Name] = builtin
+		return nil
+	}
+	delete(l_registry.constants, builtin.Name)
+	l_registry.builtins[builtin.Name] = builtin
+	return nil
+}
+
+// DefineMethod adds a method to a type, replacing any method of that type with the same name. The first
+// parameter of the method is the value it is called on.
+func (l_registry *Registry) DefineMethod(object_type object.ObjectType, method *object.Builtin) error {
+	if err := validate_builtin(method); err != nil {
+		return err
+	}
+	required := len(method.Params) - method.Optional
+	if method.Variadic {
+		required -= 1
+	}
+	if required < 1 {
+		return fmt.Errorf("method %s has no parameter for the value it is called on", method.Name)
+	}
+	l_registry.methods.Define(object_type, method)
+	return nil
+}
+
+func validate_builtin(builtin *object.Builtin) error {
+	if builtin.Name == "" {
+		return fmt.Errorf("builtin has no name")
+	}
+	if builtin.Fn == nil {
+		return fmt.Errorf("builtin %s has no function", builtin.Name)
+	}
+	optional := builtin.Optional
+	if builtin.Variadic {
+		optional += 1
+	}
+	if optional > len(builtin.Params) {
+		return fmt.Errorf("builtin %s has more optional parameters than parameters", builtin.Name)
+	}
+	return nil
+}
+
+// Define adds a constant, replacing any builtin or constant that already has the same name. Like builtins,
+// the constants of a namespace read as an object are added to that object.
+func (l_registry *Registry) Define(namespace string, name string, value object.Object) {
+	if module, ok := l_registry.module(namespace); ok {
+		module.Exports[name] = value
+		return
+	}
+	delete(l_registry.builtins, name)
+	l_registry.constants[name] = &constant{namespace: namespace, value: value}
+}
+
+// Unregister removes a builtin, a constant or the object of a namespace, it reports whether there was one
+// to remove. Methods of the same name stay, they are removed with UnregisterMethod.
+func (l_registry *Registry) Unregister(name string) bool {
+	ok := l_registry.Has(name)
+	delete(l_registry.builtins, name)
+	delete(l_registry.constants, name)
+	delete(l_registry.modules, name)
+	return ok
+}
+
+// UnregisterMethod removes a method of a type and reports whether the type had it.
+func (l_registry *Registry) UnregisterMethod(object_type object.ObjectType, name string) bool {
+	return l_registry.methods.Remove(object_type, name)
+}
+
+// UnregisterNamespace removes every builtin and method in the namespace and reports how many builtins and
+// constants there were.
+func (l_registry *Registry) UnregisterNamespace(namespace string) int {
+	count := 0
+	for name, builtin := range l_registry.builtins {
+		if builtin.Namespace == namespace {
+			delete(l_registry.builtins, name)
+			count += 1
+		}
+	}
+	for name, constant := range l_registry.constants {
+		if constant.namespace == namespace {
+			delete(l_registry.constants, name)
+			count += 1
+		}
+	}
+	if module, ok := l_registry.modules[namespace]; ok {
+		delete(l_registry.modules, namespace)
+		count += len(module.Exports)
+	}
+	for _, methods := range l_registry.methods {
+		for name, method := range methods {
+			if method.Namespace == namespace {
+				delete(methods, name)
+			}
+		}
+	}
+	return count
+}
+
+// The object of a namespace read as one, created the first time something is added to it.
+func (l_registry *Registry) module(namespace string) (*object.Module, bool) {
+	if !module_namespaces[namespace] {
+		return nil, false
+	}
+	module, ok := l_registry.modules[namespace]
+	if !ok {
+		module = &object.Module{Name: namespace, Exports: make(map[string]object.Object)}
+		l_registry.modules[namespace] = module
+	}
+	return module, true
+}
+
+func (l_registry *Registry) Lookup(name string) (*object.Builtin, bool) {
+	builtin, ok := l_registry.builtins[name]
+	return builtin, ok
+}
+
+// Value finds a builtin, a constant or the object of a namespace.
+func (l_registry *Registry) Value(name string) (object.Object, bool) {
+	if builtin, ok := l_registry.builtins[name]; ok {
+		return builtin, true
+	}
+	if constant, ok := l_registry.constants[name]; ok {
+		return constant.value, true
+	}
+	if module, ok := l_registry.modules[name]; ok {
+		return module, true
+	}
+	return nil, false
+}
+
+// Method finds the method of a type.
+func (l_registry *Registry) Method(object_type object.ObjectType, name string) (*object.Builtin, bool) {
+	return l_registry.methods.Lookup(object_type, name)
+}
+
+func (l_registry *Registry) Has(name string) bool {
+	_, ok := l_registry.Value(name)
+	return ok
+}
+
+// Names lists the registered builtins, constants and namespace objects in alphabetical order.
+func (l_registry *Registry) Names() []string {
+	names := make([]string, 0, len(l_registry.builtins)+len(l_registry.constants)+len(l_registry.modules))
+	for name := range l_registry.builtins {
+		names = append(names, name)
+	}
+	for name := range l_registry.constants {
+		names = append(names, name)
+	}
+	for name := range l_registry.modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Checks the arguments of a method call, which don't include the value it is called on, so the counts and
+// positions in the errors are those the script wrote.
+func check_method_arguments(method *object.Builtin, args []object.Object) *object.Error {
+	return check_arguments(&object.Builtin{Name: method.Name, Params: method.Params[1:], Optional: method.Optional, Variadic: method.Variadic}, args)
+}
+
+// Checks the arguments of a call against the parameters the builtin declared.
+func check_arguments(builtin *object.Builtin, args []object.Object) *object.Error {
+	params := len(builtin.Params)
+	required := params - builtin.Optional
+	if builtin.Variadic {
+		required -= 1
+	}
+
+	if len(args) < required || (!builtin.Variadic && len(args) > params) {
+		var want string
+		switch {
+		case builtin.Variadic:
+			want = fmt.Sprintf("at least %d", required)
+		case required == params:
+			want = fmt.Sprintf("%d", params)
+		default:
+			want = fmt.Sprintf("%d to %d", required, params)
+		}
+		return new_error("wrong number of arguments, got=%d, want=%s", len(args), want)
+	}
+
+	for index, arg := range args {
+		expected := builtin.Params[len(builtin.Params)-1]
+		if index < len(builtin.Params) {
+			expected = builtin.Params[index]
+		}
+		if expected == object.NUMBER_OBJECT && is_number(arg) {
+			continue
+		}
+		if expected != object.ANY_OBJECT && expected != arg.Type() {
+			return new_error("argument %d to `%s` must be %s, got %s", index+1, builtin.Name, expected, arg.Type())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,320 @@
+/*
+   Embedding Monna
+
+   Package monna is the way to run monna from a Go program. It wires the lexer, parser, resolver and
+   evaluator together and converts values between Go and monna, so the host never has to touch the AST
+   or the object package:
+
+   ```
+   interpreter := monna.New()
+   interpreter.Set("limit", 10)
+   interpreter.Run(`let double = fn(x) { x * 2 };`)
+
+   result, err := monna.CallAs[int](interpreter, "double", 21)
+   ```
+
+   Values are converted as follows, in both directions:
+
+   - Go integers            <-> INTEGER
+   - Go floats              <-> FLOAT, an INTEGER is accepted where a float is expected
+   - string                 <-> STRING
+   - bool                   <-> BOOLEAN
+   - nil                    <-> NULL
+   - slices and arrays      <-> ARRAY
+   - maps                   <-> HASH
+   - functions              <-> FUNCTION and BUILTIN
+
+   A Go function given to the interpreter can return nothing, a value, an error, or a value and an error.
+   A returned error stops the script like any other monna error. A monna function asked for as a Go
+   function is called through the interpreter that it came from.
+*/
+
+package monna
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"monna/ast"
+	"monna/evaluator"
+	"monna/lexer"
+	"monna/object"
+	"monna/parser"
+	"monna/resolver"
+	"reflect"
+	"strings"
+)
+
+// Interpreter runs monna programs against a set of globals that lives as long as the interpreter. It is
+// not safe for concurrent use.
+type Interpreter struct {
+	// Options bound every Run and Call, zero values mean no limit.
+	Options evaluator.Options
+
+	env       *object.Environment
+	resolver  *resolver.Resolver
+	evaluator *evaluator.Evaluator
+}
+
+func New() *Interpreter {
+	l_interpreter := &Interpreter{env: object.NewEnvironment(), evaluator: evaluator.New()}
+	l_interpreter.resolver = resolver.New(func(name string) bool {
+		return l_interpreter.evaluator.Builtins.Has(name)
+	})
+	return l_interpreter
+}
+
+// SetStdout sets where scripts write to, puts and print included. The default is os.Stdout.
+func (l_interpreter *Interpreter) SetStdout(stdout io.Writer) {
+	l_interpreter.evaluator.Stdout = stdout
+}
+
+// SetStderr sets where eprint writes to. The default is os.Stderr.
+func (l_interpreter *Interpreter) SetStderr(stderr io.Writer) {
+	l_interpreter.evaluator.Stderr = stderr
+}
+
+// SetStdin sets what read_line and read_all read from. The default is os.Stdin.
+func (l_interpreter *Interpreter) SetStdin(stdin io.Reader) {
+	l_interpreter.evaluator.Stdin = stdin
+}
+
+// SetFileAccess lets scripts use the files under the given directories with read_file, write_file and the
+// other filesystem builtins. An interpreter starts without any filesystem access.
+func (l_interpreter *Interpreter) SetFileAccess(access object.FileAccess) {
+	l_interpreter.evaluator.Files = access
+}
+
+// SetModulePaths sets the directories scripts import modules from, searched in order. An interpreter starts
+// without any, so scripts can't import anything.
+func (l_interpreter *Interpreter) SetModulePaths(paths ...string) {
+	l_interpreter.evaluator.Modules.SearchPaths = paths
+}
+
+// SetClock replaces the clock now(), unix() and sleep() use, i.e. with one that is fixed in tests.
+func (l_interpreter *Interpreter) SetClock(clock object.Clock) {
+	l_interpreter.evaluator.Clock = clock
+}
+
+// Seed seeds the random number generator of scripts, after it math.random() gives the same numbers on every run.
+func (l_interpreter *Interpreter) Seed(seed int64) {
+	l_interpreter.evaluator.Random.Seed(seed)
+}
+
+// Builtins is the registry of builtins of this interpreter, changes to it don't affect other interpreters.
+func (l_interpreter *Interpreter) Builtins() *evaluator.Registry {
+	return l_interpreter.evaluator.Builtins
+}
+
+// Register adds a Go function as a builtin, replacing any builtin with the same name. The parameters the
+// builtin declares are taken from the function's signature, so calls with the wrong number or type of
+// arguments fail before the function is called.
+func (l_interpreter *Interpreter) Register(namespace string, name string, fn interface{}) error {
+	value := reflect.ValueOf(fn)
+	if value.Kind() != reflect.Func {
+		return fmt.Errorf("cannot register %s, %T is not a function", name, fn)
+	}
+
+	builtin, err := l_interpreter.wrap_function(name, value)
+	if err != nil {
+		return err
+	}
+	builtin.Namespace = namespace
+	return l_interpreter.evaluator.Builtins.Register(builtin)
+}
+
+// RegisterMethod adds a Go function as a method of a type, its first parameter is the value the method is
+// called on:
+//
+//	interpreter.RegisterMethod(object.STRING_OBJECT, "shout", func(s string) string { return s + "!" })
+func (l_interpreter *Interpreter) RegisterMethod(object_type object.ObjectType, name string, fn interface{}) error {
+	value := reflect.ValueOf(fn)
+	if value.Kind() != reflect.Func {
+		return fmt.Errorf("cannot register %s, %T is not a function", name, fn)
+	}
+
+	method, err := l_interpreter.wrap_function(name, value)
+	if err != nil {
+		return err
+	}
+	return l_interpreter.evaluator.Builtins.DefineMethod(object_type, method)
+}
+
+func (l_interpreter *Interpreter) Unregister(name string) bool {
+	return l_interpreter.evaluator.Builtins.Unregister(name)
+}
+
+func (l_interpreter *Interpreter) UnregisterMethod(object_type object.ObjectType, name string) bool {
+	return l_interpreter.evaluator.Builtins.UnregisterMethod(object_type, name)
+}
+
+func (l_interpreter *Interpreter) UnregisterNamespace(namespace string) int {
+	return l_interpreter.evaluator.Builtins.UnregisterNamespace(namespace)
+}
+
+// Program is a script that has been parsed and resolved, ready to be run any number of times.
+type Program struct {
+	program *ast.Program
+
+	// Warnings from the resolver, the program still runs.
+	Warnings []string
+}
+
+// CompileError lists everything the parser or the resolver found wrong with a script.
+type CompileError struct {
+	Messages []string
+}
+
+func (err *CompileError) Error() string {
+	return "compile error: " + strings.Join(err.Messages, "; ")
+}
+
+// Error is a monna error that stopped a script. Kind tells the cause apart, i.e. object.RUNTIME_ERROR or
+// one of the execution limits like object.STEP_LIMIT_ERROR.
+type Error struct {
+	Kind    object.ErrorKind
+	Message string
+}
+
+func (err *Error) Error() string {
+	return err.Message
+}
+
+func (l_interpreter *Interpreter) Compile(source string) (*Program, error) {
+	l_parser := parser.New(lexer.New(source))
+	program := l_parser.ParseProgram()
+	if len(l_parser.Errors()) != 0 {
+		return nil, &CompileError{Messages: l_parser.Errors()}
+	}
+
+	l_interpreter.resolver.Resolve(program)
+	if len(l_interpreter.resolver.Errors()) != 0 {
+		return nil, &CompileError{Messages: l_interpreter.resolver.Errors()}
+	}
+
+	return &Program{program: program, Warnings: l_interpreter.resolver.Warnings()}, nil
+}
+
+// Run compiles and executes source, giving back the value of the last statement.
+func (l_interpreter *Interpreter) Run(source string) (interface{}, error) {
+	return l_interpreter.RunContext(context.Background(), source)
+}
+
+func (l_interpreter *Interpreter) RunContext(ctx context.Context, source string) (interface{}, error) {
+	program, err := l_interpreter.Compile(source)
+	if err != nil {
+		return nil, err
+	}
+	return l_interpreter.ExecContext(ctx, program)
+}
+
+func (l_interpreter *Interpreter) Exec(program *Program) (interface{}, error) {
+	return l_interpreter.ExecContext(context.Background(), program)
+}
+
+func (l_interpreter *Interpreter) ExecContext(ctx context.Context, program *Program) (interface{}, error) {
+	result := l_interpreter.evaluator.EvalContext(ctx, program.program, l_interpreter.env, l_interpreter.Options)
+	if result == nil {
+		return nil, nil
+	}
+	if err, ok := result.(*object.Error); ok {
+		return nil, &Error{Kind: err.Kind, Message: err.Message}
+	}
+	return l_interpreter.from_object(result)
+}
+
+// Set defines a global visible to every program run afterwards.
+func (l_interpreter *Interpreter) Set(name string, value interface{}) error {
+	var obj object.Object
+	var err error
+	if fn := reflect.ValueOf(value); fn.Kind() == reflect.Func {
+		obj, err = l_interpreter.wrap_function(name, fn)
+	} else {
+		obj, err = l_interpreter.to_object(value)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot set %s: %w", name, err)
+	}
+
+	l_interpreter.env.Set(name, obj)
+	l_interpreter.resolver.Declare(name)
+	return nil
+}
+
+func (l_interpreter *Interpreter) Get(name string) (interface{}, error) {
+	obj, ok := l_interpreter.env.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("global not found: %s", name)
+	}
+	return l_interpreter.from_object(obj)
+}
+
+// Call calls the monna function stored in the global name.
+func (l_interpreter *Interpreter) Call(name string, args ...interface{}) (interface{}, error) {
+	return l_interpreter.CallContext(context.Background(), name, args...)
+}
+
+func (l_interpreter *Interpreter) CallContext(ctx context.Context, name string, args ...interface{}) (interface{}, error) {
+	result, err := l_interpreter.call(ctx, name, args)
+	if err != nil {
+		return nil, err
+	}
+	return l_interpreter.from_object(result)
+}
+
+// GetAs reads a global converted to T.
+func GetAs[T any](l_interpreter *Interpreter, name string) (T, error) {
+	var value T
+
+	obj, ok := l_interpreter.env.Get(name)
+	if !ok {
+		return value, fmt.Errorf("global not found: %s", name)
+	}
+	err := l_interpreter.convert(obj, &value)
+	return value, err
+}
+
+// CallAs calls the monna function stored in the global name and converts its result to T.
+func CallAs[T any](l_interpreter *Interpreter, name string, args ...interface{}) (T, error) {
+	var value T
+
+	result, err := l_interpreter.call(context.Background(), name, args)
+	if err != nil {
+		return value, err
+	}
+	err = l_interpreter.convert(result, &value)
+	return value, err
+}
+
+func (l_interpreter *Interpreter) call(ctx context.Context, name string, args []interface{}) (object.Object, error) {
+	fn, ok := l_interpreter.env.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("global not found: %s", name)
+	}
+	return l_interpreter.apply(ctx, fn, args)
+}
+
+func (l_interpreter *Interpreter) apply(ctx context.Context, fn object.Object, args []interface{}) (object.Object, error) {
+	if fn.Type() != object.FUNCTION_OBJECT && fn.Type() != object.BUILTIN_OBJ {
+		return nil, fmt.Errorf("not a function: %s", fn.Type())
+	}
+
+	arguments := make([]object.Object, len(args))
+	for i, arg := range args {
+		obj, err := l_interpreter.to_object(arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i+1, err)
+		}
+		arguments[i] = obj
+	}
+
+	if function, ok := fn.(*object.Function); ok && len(function.Parameters) != len(arguments) {
+		return nil, fmt.Errorf("wrong number of arguments, got=%d, want=%d", len(arguments), len(function.Parameters))
+	}
+
+	result := l_interpreter.evaluator.ApplyContext(ctx, fn, arguments, l_interpreter.Options)
+	if err, ok := result.(*object.Error); ok {
+		return nil, &Error{Kind: err.Kind, Message: err.Message}
+	}
+	return result, nil
+}
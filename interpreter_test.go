@@ -0,0 +1,417 @@
+package monna
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"monna/object"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRun(l_test *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"5 + 5", int64(10)},
+		{`"Hello" + " " + "World!"`, "Hello World!"},
+		{"1 < 2", true},
+		{"if (false) { 1 }", nil},
+		{"let x = 5;", nil},
+		{"1 / 4.0", 0.25},
+	}
+
+	for _, tt := range tests {
+		result, err := New().Run(tt.input)
+		if err != nil {
+			l_test.Errorf("Run(%q) returned error: %s", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(result, tt.expected) {
+			l_test.Errorf("Run(%q) wrong result, expected=%#v, got=%#v", tt.input, tt.expected, result)
+		}
+	}
+}
+
+func TestRunErrors(l_test *testing.T) {
+	_, err := New().Run("let x = ;")
+	var compile_error *CompileError
+	if !errors.As(err, &compile_error) {
+		l_test.Errorf("expected *CompileError, got=%T (%v)", err, err)
+	}
+
+	_, err = New().Run("puts(foobar);")
+	if !errors.As(err, &compile_error) || compile_error.Messages[0] != "identifier not found: foobar" {
+		l_test.Errorf("expected undefined identifier compile error, got=%v", err)
+	}
+
+	_, err = New().Run("5 + true;")
+	var runtime_error *Error
+	if !errors.As(err, &runtime_error) {
+		l_test.Fatalf("expected *Error, got=%T (%v)", err, err)
+	}
+	if runtime_error.Kind != object.RUNTIME_ERROR || runtime_error.Message != "type mismatch: INTEGER + BOOLEAN" {
+		l_test.Errorf("wrong error, got=%s %q", runtime_error.Kind, runtime_error.Message)
+	}
+}
+
+func TestGlobalsPersistBetweenRuns(l_test *testing.T) {
+	interpreter := New()
+	if _, err := interpreter.Run("let add = fn(a, b) { a + b };"); err != nil {
+		l_test.Fatalf("Run returned error: %s", err)
+	}
+
+	result, err := interpreter.Run("add(2, 3)")
+	if err != nil || result != int64(5) {
+		l_test.Errorf("expected 5, got=%#v (%v)", result, err)
+	}
+
+	// A program that fails to compile declares nothing.
+	if _, err := interpreter.Compile("let half = 1; missing;"); err == nil {
+		l_test.Fatalf("expected a compile error")
+	}
+	_, err = interpreter.Compile("half;")
+	var compile_error *CompileError
+	if !errors.As(err, &compile_error) || compile_error.Messages[0] != "identifier not found: half" {
+		l_test.Errorf("expected half to be undeclared, got=%v", err)
+	}
+}
+
+func TestSetAndGet(l_test *testing.T) {
+	interpreter := New()
+
+	values := map[string]interface{}{
+		"number":  42,
+		"name":    "monna",
+		"enabled": true,
+		"list":    []int{1, 2, 3},
+		"ages":    map[string]int{"tj": 30},
+		"nothing": nil,
+	}
+	for name, value := range values {
+		if err := interpreter.Set(name, value); err != nil {
+			l_test.Fatalf("Set(%s) returned error: %s", name, err)
+		}
+	}
+
+	result, err := interpreter.Run(`if (enabled) { name + "!" }`)
+	if err != nil || result != "monna!" {
+		l_test.Errorf("expected monna!, got=%#v (%v)", result, err)
+	}
+
+	number, err := GetAs[int](interpreter, "number")
+	if err != nil || number != 42 {
+		l_test.Errorf("expected 42, got=%d (%v)", number, err)
+	}
+
+	list, err := GetAs[[]int](interpreter, "list")
+	if err != nil || !reflect.DeepEqual(list, []int{1, 2, 3}) {
+		l_test.Errorf("expected [1 2 3], got=%v (%v)", list, err)
+	}
+
+	ages, err := GetAs[map[string]int](interpreter, "ages")
+	if err != nil || !reflect.DeepEqual(ages, map[string]int{"tj": 30}) {
+		l_test.Errorf("expected map[tj:30], got=%v (%v)", ages, err)
+	}
+
+	natural, err := interpreter.Get("list")
+	if err != nil || !reflect.DeepEqual(natural, []interface{}{int64(1), int64(2), int64(3)}) {
+		l_test.Errorf("expected []interface{}{1, 2, 3}, got=%#v (%v)", natural, err)
+	}
+
+	nothing, err := interpreter.Get("nothing")
+	if err != nil || nothing != nil {
+		l_test.Errorf("expected nil, got=%#v (%v)", nothing, err)
+	}
+
+	if _, err := GetAs[string](interpreter, "number"); err == nil {
+		l_test.Errorf("expected an error converting INTEGER to string")
+	}
+	if _, err := interpreter.Get("missing"); err == nil {
+		l_test.Errorf("expected an error for a missing global")
+	}
+}
+
+func TestStructsAndEnumsToGo(l_test *testing.T) {
+	interpreter := New()
+	point, err := interpreter.Run("struct Point { x, y }; Point(1, [2.5])")
+	if err != nil || !reflect.DeepEqual(point, map[string]interface{}{"x": int64(1), "y": []interface{}{2.5}}) {
+		l_test.Errorf("expected the fields of the point, got=%#v (%v)", point, err)
+	}
+
+	interpreter.Run("let origin = Point(0, 0); let square = fn(side) { Point(side, side) };")
+	origin, err := GetAs[map[string]int](interpreter, "origin")
+	if err != nil || !reflect.DeepEqual(origin, map[string]int{"x": 0, "y": 0}) {
+		l_test.Errorf("expected map[x:0 y:0], got=%v (%v)", origin, err)
+	}
+	square, err := interpreter.Call("square", 5)
+	if err != nil || !reflect.DeepEqual(square, map[string]interface{}{"x": int64(5), "y": int64(5)}) {
+		l_test.Errorf("expected map[x:5 y:5], got=%#v (%v)", square, err)
+	}
+	if _, err := GetAs[map[int]int](interpreter, "origin"); err == nil {
+		l_test.Errorf("expected an error converting a struct to a map without string keys")
+	}
+
+	result, err := interpreter.Run("enum Result { Ok(value), Err(error) }; Result.Ok(Point(3, 4))")
+	if err != nil {
+		l_test.Fatalf("Run returned error: %s", err)
+	}
+	value, ok := result.(*object.EnumValue)
+	if !ok || value.Variant.Name != "Ok" || value.Variant.Enum.Name != "Result" || value.Values[0].Inspect() != "Point{x: 3, y: 4}" {
+		l_test.Errorf("expected the enum value Result.Ok, got=%#v", result)
+	}
+
+	// An enum value given back to a script is the same value.
+	interpreter.Set("given", value)
+	if matched, err := interpreter.Run("given == Result.Ok(Point(3, 4))"); err != nil || matched != true {
+		l_test.Errorf("expected the enum value to round trip, got=%#v (%v)", matched, err)
+	}
+}
+
+func TestGoFunctions(l_test *testing.T) {
+	interpreter := New()
+	interpreter.Set("shout", func(s string, times int) string { return strings.Repeat(strings.ToUpper(s), times) })
+	interpreter.Set("fail", func() error { return errors.New("host said no") })
+	interpreter.Set("sum", func(numbers ...int) int {
+		total := 0
+		for _, n := range numbers {
+			total += n
+		}
+		return total
+	})
+
+	result, err := interpreter.Run(`shout("hi", 2)`)
+	if err != nil || result != "HIHI" {
+		l_test.Errorf("expected HIHI, got=%#v (%v)", result, err)
+	}
+
+	result, err = interpreter.Run(`sum(1, 2, 3)`)
+	if err != nil || result != int64(6) {
+		l_test.Errorf("expected 6, got=%#v (%v)", result, err)
+	}
+
+	_, err = interpreter.Run(`fail()`)
+	if err == nil || err.Error() != "host said no" {
+		l_test.Errorf("expected host error, got=%v", err)
+	}
+
+	_, err = interpreter.Run(`shout(1, 2)`)
+	if err == nil || err.Error() != "argument 1 to `shout` must be STRING, got INTEGER" {
+		l_test.Errorf("expected argument error, got=%v", err)
+	}
+}
+
+func TestRegisterBuiltins(l_test *testing.T) {
+	sandboxed := New()
+	sandboxed.Register("text", "shout", func(s string) string { return strings.ToUpper(s) + "!" })
+
+	result, err := sandboxed.Run(`shout("hi")`)
+	if err != nil || result != "HI!" {
+		l_test.Errorf("expected HI!, got=%#v (%v)", result, err)
+	}
+
+	if _, err := New().Run(`shout("hi")`); err == nil {
+		l_test.Errorf("expected shout to only exist in the interpreter it was registered in")
+	}
+
+	_, err = sandboxed.Run(`shout("hi", "there")`)
+	if err == nil || err.Error() != "wrong number of arguments, got=2, want=1" {
+		l_test.Errorf("expected arity error, got=%v", err)
+	}
+
+	sandboxed.Register("", "cancelled", func(ctx context.Context) bool { return ctx.Err() != nil })
+	result, err = sandboxed.Run(`cancelled()`)
+	if err != nil || result != false {
+		l_test.Errorf("expected the evaluation's context, got=%#v (%v)", result, err)
+	}
+
+	sandboxed.Unregister("puts")
+	if _, err := sandboxed.Run(`puts("hi")`); err == nil || err.Error() != "compile error: identifier not found: puts" {
+		l_test.Errorf("expected puts to be removed, got=%v", err)
+	}
+
+	if count := sandboxed.UnregisterNamespace("text"); count != 1 {
+		l_test.Errorf("expected 1 builtin removed, got=%d", count)
+	}
+	if err := sandboxed.Register("", "bad", 5); err == nil {
+		l_test.Errorf("expected an error registering a non function")
+	}
+}
+
+func TestRegisterMethod(l_test *testing.T) {
+	interpreter := New()
+	if err := interpreter.RegisterMethod(object.STRING_OBJECT, "shout", func(s string, times int) string { return s + strings.Repeat("!", times) }); err != nil {
+		l_test.Fatalf("RegisterMethod failed: %s", err)
+	}
+
+	result, err := interpreter.Run(`"hi".shout(3)`)
+	if err != nil || result != "hi!!!" {
+		l_test.Errorf("expected hi!!!, got=%#v (%v)", result, err)
+	}
+	if _, err := interpreter.Run(`[1].shout(3)`); err == nil || err.Error() != "ARRAY has no method shout" {
+		l_test.Errorf("expected shout to only be a method of strings, got=%v", err)
+	}
+	if err := interpreter.RegisterMethod(object.STRING_OBJECT, "nothing", func() {}); err == nil {
+		l_test.Errorf("expected a method without parameters to be refused")
+	}
+
+	// Functions and methods are taken away separately.
+	interpreter.Register("", "shout", func(s string) string { return s + "!" })
+	interpreter.Unregister("shout")
+	if result, err := interpreter.Run(`"hi".shout(1)`); err != nil || result != "hi!" {
+		l_test.Errorf("expected the shout method to outlive the shout function, got=%#v (%v)", result, err)
+	}
+	if !interpreter.UnregisterMethod(object.STRING_OBJECT, "shout") {
+		l_test.Errorf("expected the shout method to be removed")
+	}
+	if _, err := interpreter.Run(`"hi".shout(1)`); err == nil || err.Error() != "STRING has no method shout" {
+		l_test.Errorf("expected shout to be gone, got=%v", err)
+	}
+}
+
+func TestCallMonnaFunctions(l_test *testing.T) {
+	interpreter := New()
+	_, err := interpreter.Run(`
+   let double = fn(x) { x * 2 };
+   let greet = fn(name) { "Hello " + name };
+   let apply = fn(f, x) { f(x) };
+  `)
+	if err != nil {
+		l_test.Fatalf("Run returned error: %s", err)
+	}
+
+	doubled, err := CallAs[int](interpreter, "double", 21)
+	if err != nil || doubled != 42 {
+		l_test.Errorf("expected 42, got=%d (%v)", doubled, err)
+	}
+
+	greeting, err := interpreter.Call("greet", "tj")
+	if err != nil || greeting != "Hello tj" {
+		l_test.Errorf("expected Hello tj, got=%#v (%v)", greeting, err)
+	}
+
+	applied, err := CallAs[int](interpreter, "apply", func(x int) int { return x + 1 }, 1)
+	if err != nil || applied != 2 {
+		l_test.Errorf("expected 2, got=%d (%v)", applied, err)
+	}
+
+	double, err := GetAs[func(int) (int, error)](interpreter, "double")
+	if err != nil {
+		l_test.Fatalf("GetAs returned error: %s", err)
+	}
+	if result, err := double(5); err != nil || result != 10 {
+		l_test.Errorf("expected 10, got=%d (%v)", result, err)
+	}
+
+	if _, err := interpreter.Call("double"); err == nil {
+		l_test.Errorf("expected an error for a wrong number of arguments")
+	}
+	if _, err := CallAs[string](interpreter, "double", 1); err == nil {
+		l_test.Errorf("expected an error converting INTEGER to string")
+	}
+}
+
+func TestStandardStreams(l_test *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	interpreter := New()
+	interpreter.SetStdout(&stdout)
+	interpreter.SetStderr(&stderr)
+	interpreter.SetStdin(strings.NewReader("monna\n"))
+
+	_, err := interpreter.Run(`let name = read_line(); puts("Hello " + name); eprint("done");`)
+	if err != nil {
+		l_test.Fatalf("Run returned error: %s", err)
+	}
+	if stdout.String() != "Hello monna\n" || stderr.String() != "done\n" {
+		l_test.Errorf("wrong output, stdout=%q, stderr=%q", stdout.String(), stderr.String())
+	}
+}
+
+func TestFloatsAndSeed(l_test *testing.T) {
+	interpreter := New()
+	interpreter.Set("half", func(x float64) float64 { return x / 2 })
+
+	result, err := interpreter.Run("half(3) + half(1.5)")
+	if err != nil || result != 2.25 {
+		l_test.Errorf("expected 2.25, got=%#v (%v)", result, err)
+	}
+
+	interpreter.Seed(7)
+	first, err := interpreter.Run("[math.random(), math.random(100)]")
+	interpreter.Seed(7)
+	second, _ := interpreter.Run("[math.random(), math.random(100)]")
+	if err != nil || !reflect.DeepEqual(first, second) {
+		l_test.Errorf("expected the same numbers after seeding, got=%v and %v", first, second)
+	}
+}
+
+func TestFileAccess(l_test *testing.T) {
+	interpreter := New()
+
+	_, err := interpreter.Run(`read_file("config.json")`)
+	var runtime_error *Error
+	if !errors.As(err, &runtime_error) || runtime_error.Kind != object.PERMISSION_ERROR {
+		l_test.Errorf("expected no filesystem access by default, got=%v", err)
+	}
+
+	interpreter.SetFileAccess(object.FileAccess{Roots: []string{l_test.TempDir()}})
+	result, err := interpreter.Run(`write_file("config.json", "{}"); read_file("config.json")`)
+	if err != nil || result != "{}" {
+		l_test.Errorf("expected {}, got=%#v (%v)", result, err)
+	}
+
+	result, err = interpreter.Run(`try(fn() { read_file("/etc/passwd") }, fn(err) { err["kind"] })`)
+	if err != nil || result != "PERMISSION" {
+		l_test.Errorf("expected the permission error to be caught, got=%#v (%v)", result, err)
+	}
+}
+
+func TestModulePaths(l_test *testing.T) {
+	interpreter := New()
+	directory := l_test.TempDir()
+	os.WriteFile(filepath.Join(directory, "greetings.mn"), []byte(`export let hello = fn(name) { "hello " + name };`), 0644)
+
+	_, err := interpreter.Run(`import "greetings.mn" as greetings;`)
+	var runtime_error *Error
+	if !errors.As(err, &runtime_error) || runtime_error.Kind != object.PERMISSION_ERROR {
+		l_test.Errorf("expected no imports by default, got=%v", err)
+	}
+
+	interpreter.SetModulePaths(directory)
+	result, err := interpreter.Run(`import "greetings.mn" as greetings; greetings.hello("monna")`)
+	if err != nil || result != "hello monna" {
+		l_test.Errorf("expected hello monna, got=%#v (%v)", result, err)
+	}
+}
+
+type fixed_clock time.Time
+
+func (l_clock fixed_clock) Now() time.Time                                   { return time.Time(l_clock) }
+func (l_clock fixed_clock) Sleep(ctx context.Context, d time.Duration) error { return nil }
+
+func TestClock(l_test *testing.T) {
+	interpreter := New()
+	interpreter.SetClock(fixed_clock(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)))
+
+	result, err := interpreter.Run(`sleep(1000); format_time(now(), "2006-01-02")`)
+	if err != nil || result != "2030-01-01" {
+		l_test.Errorf("expected 2030-01-01, got=%#v (%v)", result, err)
+	}
+}
+
+func TestLimits(l_test *testing.T) {
+	interpreter := New()
+	interpreter.Options.MaxSteps = 1000
+
+	_, err := interpreter.Run("let loop = fn() { loop() }; loop();")
+	var runtime_error *Error
+	if !errors.As(err, &runtime_error) || runtime_error.Kind != object.STEP_LIMIT_ERROR {
+		l_test.Errorf("expected step limit error, got=%v", err)
+	}
+}
@@ -1,16 +1,22 @@
 package lexer
 
-import "monna/token"
+import (
+	"monna/token"
+	"strings"
+)
 
 type Lexer struct {
 	input         string
 	position      int // current position in input (the current_char)
 	read_position int // current reading position in input (after current_char)
 	current_char  byte
+
+	line   int // line of current_char
+	column int // column of current_char
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.read_char()
 	return l
 }
@@ -19,49 +25,107 @@ func (l_lexer *Lexer) NextToken() token.Token {
 	var tok token.Token
 	l_lexer.skip_whitespace()
 
+	tok.Position = token.Position{Line: l_lexer.line, Column: l_lexer.column}
+
 	switch l_lexer.current_char {
 	case '=':
-		if l_lexer.peek_char() == '=' {
-			ch := l_lexer.current_char
-			l_lexer.read_char()
-			literal := string(ch) + string(l_lexer.current_char)
-			tok = token.Token{Type: token.EQ, Literal: literal}
-		} else {
-			tok = new_token(token.ASSIGN, l_lexer.current_char)
+		switch l_lexer.peek_char() {
+		case '=':
+			tok = l_lexer.read_two_char_token(token.EQ)
+		case '>':
+			tok = l_lexer.read_two_char_token(token.ARROW)
+		default:
+			tok = l_lexer.new_token(token.ASSIGN, l_lexer.current_char)
 		}
 	case '!':
 		if l_lexer.peek_char() == '=' {
-			ch := l_lexer.current_char
-			l_lexer.read_char()
-			literal := string(ch) + string(l_lexer.current_char)
-			tok = token.Token{Type: token.NOT_EQ, Literal: literal}
+			tok = l_lexer.read_two_char_token(token.NOT_EQ)
 		} else {
-			tok = new_token(token.BANG, l_lexer.current_char)
+			tok = l_lexer.new_token(token.BANG, l_lexer.current_char)
 		}
 	case ';':
-		tok = new_token(token.SEMICOLON, l_lexer.current_char)
+		tok = l_lexer.new_token(token.SEMICOLON, l_lexer.current_char)
+	case ':':
+		tok = l_lexer.new_token(token.COLON, l_lexer.current_char)
+	case '?':
+		switch l_lexer.peek_char() {
+		case '?':
+			tok = l_lexer.read_two_char_token(token.NULLISH)
+		case '.':
+			tok = l_lexer.read_two_char_token(token.OPTIONAL_DOT)
+		default:
+			tok = l_lexer.new_token(token.QUESTION, l_lexer.current_char)
+		}
+	case '.':
+		if strings.HasPrefix(l_lexer.input[l_lexer.position:], "...") {
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "...", Position: tok.Position}
+			l_lexer.read_char()
+			l_lexer.read_char()
+		} else {
+			tok = l_lexer.new_token(token.DOT, l_lexer.current_char)
+		}
 	case '(':
-		tok = new_token(token.LPAREN, l_lexer.current_char)
+		tok = l_lexer.new_token(token.LPAREN, l_lexer.current_char)
 	case ')':
-		tok = new_token(token.RPAREN, l_lexer.current_char)
+		tok = l_lexer.new_token(token.RPAREN, l_lexer.current_char)
 	case '{':
-		tok = new_token(token.LBRACE, l_lexer.current_char)
+		tok = l_lexer.new_token(token.LBRACE, l_lexer.current_char)
 	case '}':
-		tok = new_token(token.RBRACE, l_lexer.current_char)
+		tok = l_lexer.new_token(token.RBRACE, l_lexer.current_char)
+	case '[':
+		tok = l_lexer.new_token(token.LBRACKET, l_lexer.current_char)
+	case ']':
+		tok = l_lexer.new_token(token.RBRACKET, l_lexer.current_char)
 	case ',':
-		tok = new_token(token.COMMA, l_lexer.current_char)
+		tok = l_lexer.new_token(token.COMMA, l_lexer.current_char)
 	case '+':
-		tok = new_token(token.PLUS, l_lexer.current_char)
+		tok = l_lexer.new_token(token.PLUS, l_lexer.current_char)
 	case '-':
-		tok = new_token(token.MINUS, l_lexer.current_char)
+		tok = l_lexer.new_token(token.MINUS, l_lexer.current_char)
 	case '/':
-		tok = new_token(token.SLASH, l_lexer.current_char)
+		tok = l_lexer.new_token(token.SLASH, l_lexer.current_char)
 	case '*':
-		tok = new_token(token.ASTERISK, l_lexer.current_char)
+		if l_lexer.peek_char() == '*' {
+			tok = l_lexer.read_two_char_token(token.POWER)
+		} else {
+			tok = l_lexer.new_token(token.ASTERISK, l_lexer.current_char)
+		}
 	case '<':
-		tok = new_token(token.LT, l_lexer.current_char)
+		switch l_lexer.peek_char() {
+		case '=':
+			tok = l_lexer.read_two_char_token(token.LT_EQ)
+		case '<':
+			tok = l_lexer.read_two_char_token(token.SHIFT_LEFT)
+		default:
+			tok = l_lexer.new_token(token.LT, l_lexer.current_char)
+		}
 	case '>':
-		tok = new_token(token.GT, l_lexer.current_char)
+		switch l_lexer.peek_char() {
+		case '=':
+			tok = l_lexer.read_two_char_token(token.GT_EQ)
+		case '>':
+			tok = l_lexer.read_two_char_token(token.SHIFT_RIGHT)
+		default:
+			tok = l_lexer.new_token(token.GT, l_lexer.current_char)
+		}
+	case '&':
+		if l_lexer.peek_char() == '&' {
+			tok = l_lexer.read_two_char_token(token.AND)
+		} else {
+			tok = l_lexer.new_token(token.AMPERSAND, l_lexer.current_char)
+		}
+	case '|':
+		if l_lexer.peek_char() == '|' {
+			tok = l_lexer.read_two_char_token(token.OR)
+		} else {
+			tok = l_lexer.new_token(token.PIPE, l_lexer.current_char)
+		}
+	case '^':
+		tok = l_lexer.new_token(token.CARET, l_lexer.current_char)
+	case '~':
+		tok = l_lexer.new_token(token.TILDE, l_lexer.current_char)
+	case '%':
+		tok = l_lexer.new_token(token.PERCENT, l_lexer.current_char)
 	case '"':
 		tok.Literal = l_lexer.read_string()
 		tok.Type = token.STRING
@@ -76,22 +140,36 @@ func (l_lexer *Lexer) NextToken() token.Token {
 			tok.Type = token.LookupIdentifier(tok.Literal)
 			return tok
 		} else if is_digit(l_lexer.current_char) {
-			tok.Type = token.INT
-			tok.Literal = l_lexer.read_number()
+			tok.Literal, tok.Type = l_lexer.read_number()
 			return tok
 		} else {
-			tok = new_token(token.ILLEGAL, l_lexer.current_char)
+			tok = l_lexer.new_token(token.ILLEGAL, l_lexer.current_char)
 		}
 	}
 	l_lexer.read_char()
 	return tok
 }
 
-func new_token(TokenType token.TokenType, ch byte) token.Token {
-	return token.Token{Type: TokenType, Literal: string(ch)}
+// Reads an operator made of the current and the next character, i.e. <=.
+func (l_lexer *Lexer) read_two_char_token(token_type token.TokenType) token.Token {
+	position := token.Position{Line: l_lexer.line, Column: l_lexer.column}
+	ch := l_lexer.current_char
+	l_lexer.read_char()
+	return token.Token{Type: token_type, Literal: string(ch) + string(l_lexer.current_char), Position: position}
+}
+
+func (l_lexer *Lexer) new_token(TokenType token.TokenType, ch byte) token.Token {
+	position := token.Position{Line: l_lexer.line, Column: l_lexer.column}
+	return token.Token{Type: TokenType, Literal: string(ch), Position: position}
 }
 
 func (l_lexer *Lexer) read_char() {
+	if l_lexer.current_char == '\n' {
+		l_lexer.line += 1
+		l_lexer.column = 0
+	}
+	l_lexer.column += 1
+
 	if l_lexer.read_position >= len(l_lexer.input) {
 		l_lexer.current_char = 0
 	} else {
@@ -109,9 +187,10 @@ func (l_lexer *Lexer) peek_char() byte {
 	}
 }
 
+// Identifiers start with a letter or an underscore, digits may follow, i.e. atan2.
 func (l_lexer *Lexer) read_identifier() string {
 	position := l_lexer.position
-	for is_letter(l_lexer.current_char) {
+	for is_letter(l_lexer.current_char) || is_digit(l_lexer.current_char) {
 		l_lexer.read_char()
 	}
 	return l_lexer.input[position:l_lexer.position]
@@ -127,25 +206,52 @@ func (l_lexer *Lexer) skip_whitespace() {
 	}
 }
 
-func (l_lexer *Lexer) read_number() string {
+// Reads an integer, or a float when the digits are followed by a '.' and more digits, i.e. 3.14. A '.' with
+// no digit after it is left alone.
+func (l_lexer *Lexer) read_number() (string, token.TokenType) {
 	position := l_lexer.position
 	for is_digit(l_lexer.current_char) {
 		l_lexer.read_char()
 	}
-	return l_lexer.input[position:l_lexer.position]
+	if l_lexer.current_char != '.' || !is_digit(l_lexer.peek_char()) {
+		return l_lexer.input[position:l_lexer.position], token.INT
+	}
+
+	l_lexer.read_char()
+	for is_digit(l_lexer.current_char) {
+		l_lexer.read_char()
+	}
+	return l_lexer.input[position:l_lexer.position], token.FLOAT
 }
 
 func is_digit(ch byte) bool {
 	return '0' <= ch && ch <= '9'
 }
 
+// Reads a string up to the closing quote. A backslash escapes the character after it: \n, \t and \r are a
+// newline, a tab and a carriage return, any other character stands for itself, i.e. \" and \\.
 func (l_lexer *Lexer) read_string() string {
-	position := l_lexer.position + 1
+	var out strings.Builder
 	for {
 		l_lexer.read_char()
 		if l_lexer.current_char == '"' || l_lexer.current_char == 0 {
 			break
 		}
+		if l_lexer.current_char == '\\' && l_lexer.peek_char() != 0 {
+			l_lexer.read_char()
+			switch l_lexer.current_char {
+			case 'n':
+				out.WriteByte('\n')
+			case 't':
+				out.WriteByte('\t')
+			case 'r':
+				out.WriteByte('\r')
+			default:
+				out.WriteByte(l_lexer.current_char)
+			}
+			continue
+		}
+		out.WriteByte(l_lexer.current_char)
 	}
-	return l_lexer.input[position:l_lexer.position]
+	return out.String()
 }
@@ -27,6 +27,18 @@ func TestNextToken(t *testing.T) {
 						10 != 9;
             "foobar"
             "foo bar"
+            "say \"hi\"\t\\n"
+            [1, 2.5];
+            3.14.x
+            atan2 2x
+            import "lib.mn" as lib;
+            export let x = lib.name;
+            a <= b >= c && d || e
+            a % b ** c & d | e ^ ~f << g >> h
+            [x, ...rest] => _
+            struct Point { x }
+            enum E { A } e is E.A
+            a ? b : c ?? d?.e
 	`
 	tests := []struct {
 		expectedType    token.TokenType
@@ -115,6 +127,99 @@ func TestNextToken(t *testing.T) {
 
 		{token.STRING, "foobar"},
 		{token.STRING, "foo bar"},
+		{token.STRING, "say \"hi\"\t\\n"},
+
+		{token.LBRACKET, "["},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.FLOAT, "2.5"},
+		{token.RBRACKET, "]"},
+		{token.SEMICOLON, ";"},
+
+		{token.FLOAT, "3.14"},
+		{token.DOT, "."},
+		{token.IDENT, "x"},
+
+		{token.IDENT, "atan2"},
+		{token.INT, "2"},
+		{token.IDENT, "x"},
+
+		{token.IMPORT, "import"},
+		{token.STRING, "lib.mn"},
+		{token.IDENT, "as"},
+		{token.IDENT, "lib"},
+		{token.SEMICOLON, ";"},
+		{token.EXPORT, "export"},
+		{token.LET, "let"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.IDENT, "lib"},
+		{token.DOT, "."},
+		{token.IDENT, "name"},
+		{token.SEMICOLON, ";"},
+
+		{token.IDENT, "a"},
+		{token.LT_EQ, "<="},
+		{token.IDENT, "b"},
+		{token.GT_EQ, ">="},
+		{token.IDENT, "c"},
+		{token.AND, "&&"},
+		{token.IDENT, "d"},
+		{token.OR, "||"},
+		{token.IDENT, "e"},
+
+		{token.IDENT, "a"},
+		{token.PERCENT, "%"},
+		{token.IDENT, "b"},
+		{token.POWER, "**"},
+		{token.IDENT, "c"},
+		{token.AMPERSAND, "&"},
+		{token.IDENT, "d"},
+		{token.PIPE, "|"},
+		{token.IDENT, "e"},
+		{token.CARET, "^"},
+		{token.TILDE, "~"},
+		{token.IDENT, "f"},
+		{token.SHIFT_LEFT, "<<"},
+		{token.IDENT, "g"},
+		{token.SHIFT_RIGHT, ">>"},
+		{token.IDENT, "h"},
+
+		{token.LBRACKET, "["},
+		{token.IDENT, "x"},
+		{token.COMMA, ","},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "rest"},
+		{token.RBRACKET, "]"},
+		{token.ARROW, "=>"},
+		{token.IDENT, "_"},
+
+		{token.STRUCT, "struct"},
+		{token.IDENT, "Point"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "x"},
+		{token.RBRACE, "}"},
+
+		{token.ENUM, "enum"},
+		{token.IDENT, "E"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "A"},
+		{token.RBRACE, "}"},
+		{token.IDENT, "e"},
+		{token.IS, "is"},
+		{token.IDENT, "E"},
+		{token.DOT, "."},
+		{token.IDENT, "A"},
+
+		{token.IDENT, "a"},
+		{token.QUESTION, "?"},
+		{token.IDENT, "b"},
+		{token.COLON, ":"},
+		{token.IDENT, "c"},
+		{token.NULLISH, "??"},
+		{token.IDENT, "d"},
+		{token.OPTIONAL_DOT, "?."},
+		{token.IDENT, "e"},
 		{token.EOF, ""},
 	}
 
@@ -129,3 +234,41 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := `let five = 5;
+  five == 5;
+"two
+lines" x`
+
+	tests := []struct {
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{"let", 1, 1},
+		{"five", 1, 5},
+		{"=", 1, 10},
+		{"5", 1, 12},
+		{";", 1, 13},
+		{"five", 2, 3},
+		{"==", 2, 8},
+		{"5", 2, 11},
+		{";", 2, 12},
+		{"two\nlines", 3, 1},
+		{"x", 4, 8},
+		{"", 4, 9},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Position.Line != tt.expectedLine || tok.Position.Column != tt.expectedColumn {
+			t.Errorf("tests[%d] - position of %q wrong. expected=%d:%d, got=%s", i, tok.Literal, tt.expectedLine, tt.expectedColumn, tok.Position)
+		}
+	}
+}
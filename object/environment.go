@@ -9,6 +9,7 @@ package object
 
 type Environment struct {
 	store map[string]Object
+	slots []Object // locals of a resolved function call, see NewSlotEnvironment
 	outer *Environment
 }
 
@@ -60,6 +61,52 @@ func (l_environment *Environment) Get(name string) (Object, bool) {
 }
 
 func (l_environment *Environment) Set(name string, value Object) Object {
+	if l_environment.store == nil {
+		l_environment.store = make(map[string]Object)
+	}
 	l_environment.store[name] = value
 	return value
 }
+
+/*
+   Slot Environments
+
+   Looking a name up in a hash map, and then in the hash map of every enclosing environment when it isn't
+   there, is the most expensive thing the evaluator does. After the resolver has run we know two things
+   about every local variable: how many function scopes out it lives (its depth) and its position in that
+   scope (its slot). So a function call gets an environment with a plain slice of slots, and a variable is
+   read by hopping `depth` environments out and indexing the slice.
+
+   The global environment stays a hash map. The REPL adds globals one line at a time, so it can't know how
+   many there will be, and globals are also what the host sets and reads by name. Environments created with
+   NewEnvironment or NewEnclosedEnvironment have no slots, so a slot of -1 (or a missing slice) always falls
+   back to the map.
+*/
+func NewSlotEnvironment(outer *Environment, size int) *Environment {
+	return &Environment{slots: make([]Object, size), outer: outer}
+}
+
+func (l_environment *Environment) GetAt(depth int, slot int, name string) (Object, bool) {
+	env := l_environment
+	for i := 0; i < depth && env != nil; i++ {
+		env = env.outer
+	}
+	if env == nil {
+		return nil, false
+	}
+
+	if slot >= 0 && slot < len(env.slots) {
+		obj := env.slots[slot]
+		return obj, obj != nil
+	}
+	obj, ok := env.store[name]
+	return obj, ok
+}
+
+func (l_environment *Environment) SetAt(slot int, name string, value Object) Object {
+	if slot >= 0 && slot < len(l_environment.slots) {
+		l_environment.slots[slot] = value
+		return value
+	}
+	return l_environment.Set(name, value)
+}
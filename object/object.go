@@ -1,23 +1,49 @@
 package object
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"math/rand"
 	"monna/ast"
+	"monna/token"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type ObjectType string
 
 const (
 	INTEGER_OBJECT      = "INTEGER"
+	FLOAT_OBJECT        = "FLOAT"
 	BOOLEAN_OBJECT      = "BOOLEAN"
 	NULL_OBJECT         = "NULL"
 	RETURN_VALUE_OBJECT = "RETURN_VALUE"
+	TAIL_CALL_OBJECT    = "TAIL_CALL"
 	ERROR_OBJECT        = "ERROR"
 	FUNCTION_OBJECT     = "FUNCTION"
 	STRING_OBJECT       = "STRING"
 	BUILTIN_OBJ         = "BUILTIN"
+	ARRAY_OBJECT        = "ARRAY"
+	HASH_OBJECT         = "HASH"
+	REGEX_OBJECT        = "REGEX"
+	MODULE_OBJECT       = "MODULE"
+	METHOD_OBJECT       = "METHOD"
+	STRUCT_TYPE_OBJECT  = "STRUCT_TYPE"
+	STRUCT_OBJECT       = "STRUCT"
+	ENUM_OBJECT         = "ENUM"
+	VARIANT_OBJECT      = "VARIANT"
+	ENUM_VALUE_OBJECT   = "ENUM_VALUE"
+
+	ANY_OBJECT    = "ANY"    // not a type of its own, a builtin parameter of this type accepts every object
+	NUMBER_OBJECT = "NUMBER" // not a type of its own either, a builtin parameter of this type accepts INTEGER and FLOAT
 )
 
 type Object interface {
@@ -38,6 +64,30 @@ func (i *Integer) Inspect() string {
 	return fmt.Sprintf("%d", i.Value)
 }
 
+// Float
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType {
+	return FLOAT_OBJECT
+}
+
+// A float always shows a decimal point or an exponent, so 2.0 can't be mistaken for the integer 2.
+func (f *Float) Inspect() string {
+	magnitude := math.Abs(f.Value)
+	format := byte('g')
+	if magnitude == 0 || (magnitude >= 1e-6 && magnitude < 1e21) {
+		format = 'f'
+	}
+
+	inspect := strconv.FormatFloat(f.Value, format, -1, 64)
+	if !strings.ContainsAny(inspect, ".eIN") {
+		inspect += ".0"
+	}
+	return inspect
+}
+
 // Booleans
 type Boolean struct {
 	Value bool
@@ -70,19 +120,52 @@ type ReturnValue struct {
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJECT }
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
+// Tail Call
+//
+// Returned instead of calling a function from tail position, the function being applied at the moment
+// makes the call itself once its own frame is gone. It never escapes apply_function.
+type TailCall struct {
+	Function  Object
+	Arguments []Object
+	Env       *Environment
+	Position  token.Position
+}
+
+func (tc *TailCall) Type() ObjectType { return TAIL_CALL_OBJECT }
+func (tc *TailCall) Inspect() string  { return "tail call to " + tc.Function.Inspect() }
+
 // Error
+type ErrorKind string
+
+const (
+	RUNTIME_ERROR          ErrorKind = "RUNTIME"
+	STEP_LIMIT_ERROR       ErrorKind = "STEP_LIMIT"
+	DEPTH_LIMIT_ERROR      ErrorKind = "DEPTH_LIMIT"
+	ALLOCATION_LIMIT_ERROR ErrorKind = "ALLOCATION_LIMIT"
+	CANCELLED_ERROR        ErrorKind = "CANCELLED"
+	PERMISSION_ERROR       ErrorKind = "PERMISSION"
+)
+
 type Error struct {
+	Kind    ErrorKind
 	Message string
 }
 
 func (err *Error) Type() ObjectType { return ERROR_OBJECT }
 func (err *Error) Inspect() string  { return "ERROR: " + err.Message }
 
+// Catchable reports whether a script can recover from the error with try. Hitting an execution limit or
+// being cancelled always stops the script.
+func (err *Error) Catchable() bool {
+	return err.Kind == RUNTIME_ERROR || err.Kind == PERMISSION_ERROR
+}
+
 // Function
 type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
+	Slots      int // number of local slots, -1 if the body was not resolved and locals are kept by name
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJECT }
@@ -113,11 +196,371 @@ func (s *String) Type() ObjectType { return STRING_OBJECT }
 func (s *String) Inspect() string  { return s.Value }
 
 // Built-in functions
-type BuiltinFunction func(args ...Object) Object
+type BuiltinFunction func(call *CallContext, args ...Object) Object
+
+// CallContext tells a builtin about the call it is answering.
+type CallContext struct {
+	Context  context.Context // cancelled when the evaluation is, long running builtins should watch it
+	Stdout   io.Writer       // the standard streams of the script, set by the host
+	Stderr   io.Writer
+	Stdin    *bufio.Reader
+	Env      *Environment   // the environment of the caller, nil when the host makes the call
+	Position token.Position // where the call is in the source
+	Random   *rand.Rand     // the random number generator of the evaluator, so a seed makes scripts reproducible
+	Files    FileAccess     // where the filesystem builtins may go
+	Clock    Clock          // where the time builtins get the time from
+
+	// Apply calls a monna function or builtin, i.e. a callback given to the builtin. An error from the
+	// callback is returned as it is, the builtin should stop and return it too.
+	Apply func(fn Object, args ...Object) Object
+
+	// Allocate counts the objects a builtin is about to create against the allocation limit, before it
+	// creates them. When that would go over the limit it gives the error the builtin should return.
+	Allocate func(count int64) *Error
+}
 
+// FileAccess is what the host lets scripts do with files. The zero value allows nothing.
+type FileAccess struct {
+	Roots    []string // directories scripts may use, with everything below them, relative paths start at the first
+	ReadOnly bool     // scripts may read files but not write or remove them
+}
+
+// Clock tells the time to scripts. The host can give the evaluator its own, so scripts using time give the
+// same results on every run.
+type Clock interface {
+	Now() time.Time
+
+	// Sleep waits for d to pass, or for ctx to be done in which case it returns ctx.Err().
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+// A Builtin declares the parameters it takes, the evaluator checks the arguments against them before Fn is
+// called so Fn can use type assertions without checking.
 type Builtin struct {
-	Fn BuiltinFunction
+	Name      string
+	Namespace string       // groups related builtins, i.e. "math", so they can be removed together
+	Params    []ObjectType // the type of each parameter, ANY_OBJECT accepts everything
+	Optional  int          // how many of the trailing parameters may be left out, not counting a variadic one
+	Variadic  bool         // the last parameter may be repeated any number of times, including none
+	Fn        BuiltinFunction
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
 func (b *Builtin) Inspect() string  { return "Builtin Function" }
+
+/*
+   Methods
+
+   Values of the core types have methods, called as value.name(args). A method is a Builtin whose first
+   parameter is the value it is called on, so "abc".upper() calls the upper builtin with "abc":
+
+   ```
+   table := MethodTable{}
+   table.Define(STRING_OBJECT, upper)
+   ```
+
+   Looking a method up on a value gives a BoundMethod, which remembers the value until it is called.
+*/
+
+// MethodTable holds the methods of each type by name.
+type MethodTable map[ObjectType]map[string]*Builtin
+
+func (mt MethodTable) Define(object_type ObjectType, method *Builtin) {
+	if mt[object_type] == nil {
+		mt[object_type] = make(map[string]*Builtin)
+	}
+	mt[object_type][method.Name] = method
+}
+
+func (mt MethodTable) Lookup(object_type ObjectType, name string) (*Builtin, bool) {
+	method, ok := mt[object_type][name]
+	return method, ok
+}
+
+// Remove takes a method away from a type, it reports whether the type had it.
+func (mt MethodTable) Remove(object_type ObjectType, name string) bool {
+	_, ok := mt[object_type][name]
+	delete(mt[object_type], name)
+	return ok
+}
+
+// BoundMethod is a method looked up on a value, calling it calls Method with Receiver as the first argument.
+type BoundMethod struct {
+	Receiver Object
+	Method   *Builtin
+}
+
+func (bm *BoundMethod) Type() ObjectType { return METHOD_OBJECT }
+func (bm *BoundMethod) Inspect() string {
+	return "method " + bm.Method.Name + " of " + string(bm.Receiver.Type())
+}
+
+// Array
+type Array struct {
+	Elements []Object
+}
+
+func (a *Array) Type() ObjectType { return ARRAY_OBJECT }
+func (a *Array) Inspect() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, e := range a.Elements {
+		elements = append(elements, e.Inspect())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+// Regex is a compiled regular expression, in the syntax of Go's regexp package.
+type Regex struct {
+	Value *regexp.Regexp
+}
+
+func (r *Regex) Type() ObjectType { return REGEX_OBJECT }
+func (r *Regex) Inspect() string  { return "regex(" + strconv.Quote(r.Value.String()) + ")" }
+
+// Module is an imported file, or a namespace of builtins like math, what it exports is read with module.name.
+type Module struct {
+	Name    string // the path it was imported by, or the namespace
+	Exports map[string]Object
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJECT }
+func (m *Module) Inspect() string  { return "module(" + strconv.Quote(m.Name) + ")" }
+
+/*
+   Structs
+
+   A struct declaration gives a StructType, which is called like a function to build instances with a
+   value for every field, in the order they were declared:
+
+   ```
+   struct Point { x, y };
+   let p = Point(1, 2);
+   p.x;               // 1
+   p.with("x", 3);    // Point{x: 3, y: 2}
+   ```
+
+   An instance has exactly the fields of its type. Reading or setting any other is an error, and like the
+   other values an instance is never changed in place, with gives a new one.
+*/
+
+// StructType is the constructor a struct declaration binds.
+type StructType struct {
+	Name   string
+	Fields []string
+}
+
+func (st *StructType) Type() ObjectType { return STRUCT_TYPE_OBJECT }
+func (st *StructType) Inspect() string {
+	if len(st.Fields) == 0 {
+		return "struct " + st.Name + " {}"
+	}
+	return "struct " + st.Name + " { " + strings.Join(st.Fields, ", ") + " }"
+}
+
+// Field gives the position of a field in the values of an instance.
+func (st *StructType) Field(name string) (int, bool) {
+	for i, field := range st.Fields {
+		if field == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// StructInstance holds a value for each field of its struct, in the order of StructType.Fields.
+type StructInstance struct {
+	Struct *StructType
+	Values []Object
+}
+
+func (si *StructInstance) Type() ObjectType { return STRUCT_OBJECT }
+func (si *StructInstance) Inspect() string {
+	fields := []string{}
+	for i, field := range si.Struct.Fields {
+		fields = append(fields, field+": "+si.Values[i].Inspect())
+	}
+	return si.Struct.Name + "{" + strings.Join(fields, ", ") + "}"
+}
+
+func (si *StructInstance) Get(field string) (Object, bool) {
+	i, ok := si.Struct.Field(field)
+	if !ok {
+		return nil, false
+	}
+	return si.Values[i], true
+}
+
+/*
+   Enums
+
+   An enum declaration gives an EnumType, its variants are read from it by name. A variant with fields is
+   called like a function to build a value carrying them, one without fields is a value already:
+
+   ```
+   enum Result { Ok(value), Err(error) };
+   let r = Result.Ok(5);   // Ok(5)
+   r.value;                // 5
+   r is Result.Ok;         // true
+
+   enum Status { Pending, Done(result) };
+   Status.Pending;         // Pending
+   ```
+*/
+
+// EnumType is what an enum declaration binds.
+type EnumType struct {
+	Name     string
+	Variants []*Variant
+}
+
+func (et *EnumType) Type() ObjectType { return ENUM_OBJECT }
+func (et *EnumType) Inspect() string {
+	variants := []string{}
+	for _, variant := range et.Variants {
+		variants = append(variants, variant.Declaration())
+	}
+	return "enum " + et.Name + " { " + strings.Join(variants, ", ") + " }"
+}
+
+func (et *EnumType) Variant(name string) (*Variant, bool) {
+	for _, variant := range et.Variants {
+		if variant.Name == name {
+			return variant, true
+		}
+	}
+	return nil, false
+}
+
+// Variant is one of the cases of an enum, and the constructor of its values when it has fields.
+type Variant struct {
+	Enum   *EnumType
+	Name   string
+	Fields []string
+}
+
+func (v *Variant) Type() ObjectType { return VARIANT_OBJECT }
+func (v *Variant) Inspect() string  { return v.Enum.Name + "." + v.Name }
+
+// Declaration gives the variant the way it was declared, Ok(value).
+func (v *Variant) Declaration() string {
+	if len(v.Fields) == 0 {
+		return v.Name
+	}
+	return v.Name + "(" + strings.Join(v.Fields, ", ") + ")"
+}
+
+// EnumValue is a value of a variant, with a value for each of its fields.
+type EnumValue struct {
+	Variant *Variant
+	Values  []Object
+}
+
+func (ev *EnumValue) Type() ObjectType { return ENUM_VALUE_OBJECT }
+func (ev *EnumValue) Inspect() string {
+	if len(ev.Values) == 0 {
+		return ev.Variant.Name
+	}
+	values := []string{}
+	for _, value := range ev.Values {
+		values = append(values, value.Inspect())
+	}
+	return ev.Variant.Name + "(" + strings.Join(values, ", ") + ")"
+}
+
+func (ev *EnumValue) Get(field string) (Object, bool) {
+	for i, name := range ev.Variant.Fields {
+		if name == field {
+			return ev.Values[i], true
+		}
+	}
+	return nil, false
+}
+
+/*
+   Hashes
+
+   A hash can't use the objects themselves as keys of a Go map, two *object.String with the same value are
+   different pointers. Instead every object that can be a key knows how to turn itself into a HashKey, which
+   is its type plus a number that is the same for equal values. The original key is kept next to the value
+   in a HashPair so it can be given back when iterating.
+*/
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+type Hashable interface {
+	HashKey() HashKey
+}
+
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+type Hash struct {
+	Pairs map[HashKey]HashPair
+}
+
+func NewHash() *Hash {
+	return &Hash{Pairs: make(map[HashKey]HashPair)}
+}
+
+func (h *Hash) Type() ObjectType { return HASH_OBJECT }
+func (h *Hash) Inspect() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, pair := range h.SortedPairs() {
+		pairs = append(pairs, pair.Key.Inspect()+": "+pair.Value.Inspect())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// SortedPairs gives the pairs ordered by their keys, so printing a hash always gives the same output.
+func (h *Hash) SortedPairs() []HashPair {
+	pairs := make([]HashPair, 0, len(h.Pairs))
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].Key.Type() != pairs[j].Key.Type() {
+			return pairs[i].Key.Type() < pairs[j].Key.Type()
+		}
+		if left, ok := pairs[i].Key.(*Integer); ok {
+			return left.Value < pairs[j].Key.(*Integer).Value
+		}
+		return pairs[i].Key.Inspect() < pairs[j].Key.Inspect()
+	})
+	return pairs
+}
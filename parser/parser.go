@@ -12,25 +12,52 @@ import (
 const (
 	_ int = iota // iota means start from 0, hence _ starts from 0
 	LOWEST
+	CONDITIONAL // c ? a : b
+	NULLISH     // a ?? b
+	LOGICAL_OR  // ||
+	LOGICAL_AND // &&
 	EQUALS      // ==
-	LESSGREATER // > OR <
+	LESSGREATER // > OR < OR <= OR >=
+	BITWISE_OR  // |
+	BITWISE_XOR // ^
+	BITWISE_AND // &
+	SHIFT       // << OR >>
 	SUM         // +
-	PRODUCT     // *
-	PREFIX      // -x OR !x
-	CALL        // simple_function(x)
+	PRODUCT     // * OR / OR %
+	PREFIX      // -x OR !x OR ~x
+	POWER       // x ** y, binds tighter than a prefix operator so -2 ** 2 is -(2 ** 2)
+	CALL        // simple_function(x) OR object.member
+	INDEX       // array[index]
 )
 
 // Precedence Table
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL,
+	token.EQ:           EQUALS,
+	token.NOT_EQ:       EQUALS,
+	token.IS:           EQUALS,
+	token.LT:           LESSGREATER,
+	token.GT:           LESSGREATER,
+	token.LT_EQ:        LESSGREATER,
+	token.GT_EQ:        LESSGREATER,
+	token.AND:          LOGICAL_AND,
+	token.OR:           LOGICAL_OR,
+	token.PLUS:         SUM,
+	token.MINUS:        SUM,
+	token.SLASH:        PRODUCT,
+	token.ASTERISK:     PRODUCT,
+	token.PERCENT:      PRODUCT,
+	token.POWER:        POWER,
+	token.AMPERSAND:    BITWISE_AND,
+	token.PIPE:         BITWISE_OR,
+	token.CARET:        BITWISE_XOR,
+	token.SHIFT_LEFT:   SHIFT,
+	token.SHIFT_RIGHT:  SHIFT,
+	token.LPAREN:       CALL,
+	token.LBRACKET:     INDEX,
+	token.DOT:          CALL,
+	token.OPTIONAL_DOT: CALL,
+	token.QUESTION:     CONDITIONAL,
+	token.NULLISH:      NULLISH,
 }
 
 func (l_parser *Parser) peek_precedence() int {
@@ -68,6 +95,10 @@ type Parser struct {
 
 	errors []string
 
+	// Set while parsing a match guard, where the => after an identifier or parentheses ends the guard
+	// instead of starting an arrow function.
+	in_guard bool
+
 	prefix_parse_functions map[token.TokenType]prefix_parse_function
 	infix_parse_functions  map[token.TokenType]infix_parse_function
 }
@@ -83,8 +114,10 @@ func New(l_lexer *lexer.Lexer) *Parser {
 	l_parser.prefix_parse_functions = make(map[token.TokenType]prefix_parse_function)
 	l_parser.register_prefix(token.IDENT, l_parser.parse_identifier)
 	l_parser.register_prefix(token.INT, l_parser.parse_integer_literal)
+	l_parser.register_prefix(token.FLOAT, l_parser.parse_float_literal)
 	l_parser.register_prefix(token.BANG, l_parser.parse_prefix_expression)
 	l_parser.register_prefix(token.MINUS, l_parser.parse_prefix_expression)
+	l_parser.register_prefix(token.TILDE, l_parser.parse_prefix_expression)
 	l_parser.register_prefix(token.STRING, l_parser.parse_string_literal)
 
 	// Infix Operation
@@ -97,6 +130,18 @@ func New(l_lexer *lexer.Lexer) *Parser {
 	l_parser.register_infix(token.NOT_EQ, l_parser.parse_infix_expression)
 	l_parser.register_infix(token.LT, l_parser.parse_infix_expression)
 	l_parser.register_infix(token.GT, l_parser.parse_infix_expression)
+	l_parser.register_infix(token.LT_EQ, l_parser.parse_infix_expression)
+	l_parser.register_infix(token.GT_EQ, l_parser.parse_infix_expression)
+	l_parser.register_infix(token.IS, l_parser.parse_infix_expression)
+	l_parser.register_infix(token.AND, l_parser.parse_infix_expression)
+	l_parser.register_infix(token.OR, l_parser.parse_infix_expression)
+	l_parser.register_infix(token.PERCENT, l_parser.parse_infix_expression)
+	l_parser.register_infix(token.POWER, l_parser.parse_infix_expression)
+	l_parser.register_infix(token.AMPERSAND, l_parser.parse_infix_expression)
+	l_parser.register_infix(token.PIPE, l_parser.parse_infix_expression)
+	l_parser.register_infix(token.CARET, l_parser.parse_infix_expression)
+	l_parser.register_infix(token.SHIFT_LEFT, l_parser.parse_infix_expression)
+	l_parser.register_infix(token.SHIFT_RIGHT, l_parser.parse_infix_expression)
 
 	// Boolean
 	l_parser.register_prefix(token.TRUE, l_parser.parse_boolean)
@@ -114,6 +159,19 @@ func New(l_lexer *lexer.Lexer) *Parser {
 	// Call Expression
 	l_parser.register_infix(token.LPAREN, l_parser.parse_call_expression)
 
+	// Arrays
+	l_parser.register_prefix(token.LBRACKET, l_parser.parse_array_literal)
+	l_parser.register_infix(token.LBRACKET, l_parser.parse_index_expression)
+
+	// Hashes
+	l_parser.register_prefix(token.LBRACE, l_parser.parse_hash_literal)
+
+	// Member Access
+	l_parser.register_infix(token.DOT, l_parser.parse_member_expression)
+	l_parser.register_infix(token.OPTIONAL_DOT, l_parser.parse_member_expression)
+	l_parser.register_infix(token.QUESTION, l_parser.parse_conditional_expression)
+	l_parser.register_infix(token.NULLISH, l_parser.parse_infix_expression)
+
 	return l_parser
 }
 
@@ -169,6 +227,19 @@ func (l_parser *Parser) parse_statement() ast.Statement {
 		return l_parser.parse_let_statement()
 	case token.RETURN:
 		return l_parser.parse_return_statement()
+	case token.IMPORT:
+		return l_parser.parse_import_statement()
+	case token.EXPORT:
+		return l_parser.parse_export_statement()
+	case token.STRUCT:
+		return l_parser.parse_struct_statement()
+	case token.ENUM:
+		return l_parser.parse_enum_statement()
+	case token.FUNCTION:
+		if l_parser.peek_token_is(token.IDENT) {
+			return l_parser.parse_function_statement()
+		}
+		return l_parser.parse_expression_statement()
 	default:
 		return l_parser.parse_expression_statement()
 	}
@@ -179,11 +250,19 @@ func (l_parser *Parser) parse_let_statement() *ast.LetStatement {
 
 	statement := &ast.LetStatement{Token: l_parser.current_token}
 
-	if !l_parser.expect_peek(token.IDENT) {
+	switch {
+	case l_parser.peek_token_is(token.LBRACKET), l_parser.peek_token_is(token.LBRACE):
+		l_parser.next_token()
+		statement.Name = l_parser.parse_pattern()
+		if statement.Name == nil {
+			return nil
+		}
+	case l_parser.expect_peek(token.IDENT):
+		statement.Name = &ast.Identifier{Token: l_parser.current_token, Value: l_parser.current_token.Literal}
+	default:
 		return nil
 	}
 
-	statement.Name = &ast.Identifier{Token: l_parser.current_token, Value: l_parser.current_token.Literal}
 	if !l_parser.expect_peek(token.ASSIGN) {
 		return nil
 	}
@@ -197,6 +276,160 @@ func (l_parser *Parser) parse_let_statement() *ast.LetStatement {
 	return statement
 }
 
+// import "path/to/lib.mn" as lib; where `as` is only a keyword in this one place.
+func (l_parser *Parser) parse_import_statement() ast.Statement {
+	statement := &ast.ImportStatement{Token: l_parser.current_token}
+
+	if !l_parser.expect_peek(token.STRING) {
+		return nil
+	}
+	statement.Path = l_parser.current_token.Literal
+
+	if !l_parser.peek_token_is(token.IDENT) || l_parser.peek_token.Literal != "as" {
+		message := fmt.Sprintf("expected as after the import path, got %s", l_parser.peek_token.Literal)
+		l_parser.errors = append(l_parser.errors, message)
+		return nil
+	}
+	l_parser.next_token()
+
+	if !l_parser.expect_peek(token.IDENT) {
+		return nil
+	}
+	statement.Name = &ast.Identifier{Token: l_parser.current_token, Value: l_parser.current_token.Literal}
+
+	if l_parser.peek_token_is(token.SEMICOLON) {
+		l_parser.next_token()
+	}
+	return statement
+}
+
+// export is followed by the declaration it exports.
+func (l_parser *Parser) parse_export_statement() ast.Statement {
+	statement := &ast.ExportStatement{Token: l_parser.current_token}
+
+	switch l_parser.peek_token.Type {
+	case token.LET:
+		l_parser.next_token()
+		if declaration := l_parser.parse_let_statement(); declaration != nil {
+			statement.Statement = declaration
+		}
+	case token.STRUCT:
+		l_parser.next_token()
+		statement.Statement = l_parser.parse_struct_statement()
+	case token.ENUM:
+		l_parser.next_token()
+		statement.Statement = l_parser.parse_enum_statement()
+	case token.FUNCTION:
+		l_parser.next_token()
+		statement.Statement = l_parser.parse_function_statement()
+	default:
+		message := fmt.Sprintf("expected a declaration after export, got %s", l_parser.peek_token.Literal)
+		l_parser.errors = append(l_parser.errors, message)
+	}
+
+	if statement.Statement == nil {
+		return nil
+	}
+	return statement
+}
+
+// struct Point { x, y }; declares Point, a constructor taking the fields in order.
+func (l_parser *Parser) parse_struct_statement() ast.Statement {
+	statement := &ast.StructStatement{Token: l_parser.current_token}
+
+	if !l_parser.expect_peek(token.IDENT) {
+		return nil
+	}
+	statement.Name = &ast.Identifier{Token: l_parser.current_token, Value: l_parser.current_token.Literal}
+	if !l_parser.expect_peek(token.LBRACE) {
+		return nil
+	}
+
+	fields := l_parser.parse_field_list(token.RBRACE, "struct "+statement.Name.Value)
+	if fields == nil {
+		return nil
+	}
+	statement.Fields = fields
+
+	if l_parser.peek_token_is(token.SEMICOLON) {
+		l_parser.next_token()
+	}
+	return statement
+}
+
+// enum Result { Ok(value), Err(error) }; declares Result, whose variants are read as Result.Ok.
+func (l_parser *Parser) parse_enum_statement() ast.Statement {
+	statement := &ast.EnumStatement{Token: l_parser.current_token}
+
+	if !l_parser.expect_peek(token.IDENT) {
+		return nil
+	}
+	statement.Name = &ast.Identifier{Token: l_parser.current_token, Value: l_parser.current_token.Literal}
+	if !l_parser.expect_peek(token.LBRACE) {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	for !l_parser.peek_token_is(token.RBRACE) {
+		if !l_parser.expect_peek(token.IDENT) {
+			return nil
+		}
+		variant := ast.EnumVariant{Name: &ast.Identifier{Token: l_parser.current_token, Value: l_parser.current_token.Literal}}
+		if seen[variant.Name.Value] {
+			message := fmt.Sprintf("duplicate variant %s in enum %s", variant.Name.Value, statement.Name.Value)
+			l_parser.errors = append(l_parser.errors, message)
+			return nil
+		}
+		seen[variant.Name.Value] = true
+
+		if l_parser.peek_token_is(token.LPAREN) {
+			l_parser.next_token()
+			variant.Fields = l_parser.parse_field_list(token.RPAREN, "variant "+variant.Name.Value)
+			if variant.Fields == nil {
+				return nil
+			}
+		}
+		statement.Variants = append(statement.Variants, variant)
+
+		if !l_parser.peek_token_is(token.RBRACE) && !l_parser.expect_peek(token.COMMA) {
+			return nil
+		}
+	}
+	l_parser.next_token()
+
+	if l_parser.peek_token_is(token.SEMICOLON) {
+		l_parser.next_token()
+	}
+	return statement
+}
+
+// The field names of a struct or an enum variant, up to the closing token. Gives nil on an error, an empty
+// list when there are no fields.
+func (l_parser *Parser) parse_field_list(end token.TokenType, owner string) []*ast.Identifier {
+	fields := []*ast.Identifier{}
+
+	seen := make(map[string]bool)
+	for !l_parser.peek_token_is(end) {
+		if !l_parser.expect_peek(token.IDENT) {
+			return nil
+		}
+		field := &ast.Identifier{Token: l_parser.current_token, Value: l_parser.current_token.Literal}
+		if seen[field.Value] {
+			message := fmt.Sprintf("duplicate field %s in %s", field.Value, owner)
+			l_parser.errors = append(l_parser.errors, message)
+			return nil
+		}
+		seen[field.Value] = true
+		fields = append(fields, field)
+
+		if !l_parser.peek_token_is(end) && !l_parser.expect_peek(token.COMMA) {
+			return nil
+		}
+	}
+	l_parser.next_token()
+	return fields
+}
+
 func (l_parser *Parser) parse_return_statement() *ast.ReturnStatement {
 	//defer untrace(trace("parse_return_statement"))
 
@@ -223,7 +456,14 @@ func (l_parser *Parser) parse_expression_statement() *ast.ExpressionStatement {
 
 func (l_parser *Parser) parse_identifier() ast.Expression {
 	//defer untrace(trace("parse_identifier"))
-	return &ast.Identifier{Token: l_parser.current_token, Value: l_parser.current_token.Literal}
+	if l_parser.current_token.Literal == "match" && l_parser.peek_token_is(token.LPAREN) {
+		return l_parser.parse_match_expression()
+	}
+	identifier := &ast.Identifier{Token: l_parser.current_token, Value: l_parser.current_token.Literal}
+	if l_parser.peek_token_is(token.ARROW) && !l_parser.in_guard {
+		return l_parser.parse_arrow_function([]*ast.Identifier{identifier})
+	}
+	return identifier
 }
 
 func (l_parser *Parser) parse_integer_literal() ast.Expression {
@@ -239,6 +479,19 @@ func (l_parser *Parser) parse_integer_literal() ast.Expression {
 	return literal
 }
 
+func (l_parser *Parser) parse_float_literal() ast.Expression {
+	//defer untrace(trace("parse_float_literal"))
+	literal := &ast.FloatLiteral{Token: l_parser.current_token}
+	value, error := strconv.ParseFloat(l_parser.current_token.Literal, 64)
+	if error != nil {
+		message := fmt.Sprintf("could not parse %q as float", l_parser.current_token.Literal)
+		l_parser.errors = append(l_parser.errors, message)
+		return nil
+	}
+	literal.Value = value
+	return literal
+}
+
 // Here lies the heart of Pratt Parsing
 func (l_parser *Parser) parse_expression(precedence int) ast.Expression {
 	//defer untrace(trace("parse_expression"))
@@ -280,6 +533,10 @@ func (l_parser *Parser) parse_infix_expression(left ast.Expression) ast.Expressi
 		Left:     left,
 	}
 	precedence := l_parser.current_precedence()
+	if l_parser.current_token_is(token.POWER) {
+		// ** is right associative, 2 ** 3 ** 2 is 2 ** (3 ** 2), so its right side takes another **
+		precedence -= 1
+	}
 	l_parser.next_token()
 	expression.Right = l_parser.parse_expression(precedence)
 
@@ -306,16 +563,54 @@ func (l_parser *Parser) parse_boolean() ast.Expression {
 	}
 }
 
-func (l_parser *Parser) parse_grouped_expression() ast.Expression {
-	//defer untrace(trace("parse_grouped_expression"))
+// condition ? consequence : alternative, where the alternative extends as far right as it can so
+// a ? b : c ? d : e is a ? b : (c ? d : e).
+func (l_parser *Parser) parse_conditional_expression(condition ast.Expression) ast.Expression {
+	expression := &ast.ConditionalExpression{Token: l_parser.current_token, Condition: condition}
+
 	l_parser.next_token()
-	expression := l_parser.parse_expression(LOWEST)
-	if !l_parser.expect_peek(token.RPAREN) {
+	expression.Consequence = l_parser.parse_expression(LOWEST)
+	if !l_parser.expect_peek(token.COLON) {
 		return nil
 	}
+	l_parser.next_token()
+	expression.Alternative = l_parser.parse_expression(LOWEST)
 	return expression
 }
 
+// Parentheses group an expression, or hold the parameters of an arrow function when a => follows them.
+func (l_parser *Parser) parse_grouped_expression() ast.Expression {
+	//defer untrace(trace("parse_grouped_expression"))
+	in_guard := l_parser.in_guard
+	l_parser.in_guard = false
+	expressions := l_parser.parse_expression_list(token.RPAREN)
+	l_parser.in_guard = in_guard
+	if expressions == nil {
+		return nil
+	}
+
+	if l_parser.peek_token_is(token.ARROW) && !l_parser.in_guard {
+		parameters := []*ast.Identifier{}
+		for _, expression := range expressions {
+			parameter, ok := expression.(*ast.Identifier)
+			if !ok {
+				message := fmt.Sprintf("expected a parameter name, got %s", expression.String())
+				l_parser.errors = append(l_parser.errors, message)
+				return nil
+			}
+			parameters = append(parameters, parameter)
+		}
+		return l_parser.parse_arrow_function(parameters)
+	}
+
+	if len(expressions) != 1 {
+		message := fmt.Sprintf("expected => after the parameters of an arrow function, got %s", l_parser.peek_token.Literal)
+		l_parser.errors = append(l_parser.errors, message)
+		return nil
+	}
+	return expressions[0]
+}
+
 func (l_parser *Parser) parse_if_expression() ast.Expression {
 	//defer untrace(trace("parse_if_expression"))
 	expression := &ast.IfExpression{
@@ -380,9 +675,314 @@ func (l_parser *Parser) parse_function_literal() ast.Expression {
 	}
 
 	literal.Body = l_parser.parse_block_statement()
+	mark_tail_calls(literal.Body, true)
+	return literal
+}
+
+// x => x * 2 or (a, b) => { ... }, with the parameters already parsed and the => next. A body that isn't
+// a block is a single expression, so a hash has to be put in parentheses to be returned.
+func (l_parser *Parser) parse_arrow_function(parameters []*ast.Identifier) ast.Expression {
+	l_parser.next_token()
+	literal := &ast.FunctionLiteral{Token: l_parser.current_token, Parameters: parameters}
+	l_parser.next_token()
+
+	if l_parser.current_token_is(token.LBRACE) {
+		literal.Body = l_parser.parse_block_statement()
+	} else {
+		statement := &ast.ExpressionStatement{Token: l_parser.current_token}
+		statement.Expression = l_parser.parse_expression(LOWEST)
+		if statement.Expression == nil {
+			return nil
+		}
+		literal.Body = &ast.BlockStatement{Token: statement.Token, Statements: []ast.Statement{statement}}
+	}
+	mark_tail_calls(literal.Body, true)
 	return literal
 }
 
+// fn add(a, b) { a + b } binds add where it is declared, like a let would.
+func (l_parser *Parser) parse_function_statement() ast.Statement {
+	statement := &ast.FunctionStatement{Token: l_parser.current_token}
+	if !l_parser.expect_peek(token.IDENT) {
+		return nil
+	}
+	statement.Name = &ast.Identifier{Token: l_parser.current_token, Value: l_parser.current_token.Literal}
+
+	literal, ok := l_parser.parse_function_literal().(*ast.FunctionLiteral)
+	if !ok {
+		return nil
+	}
+	literal.Token = statement.Token
+	statement.Function = literal
+
+	if l_parser.peek_token_is(token.SEMICOLON) {
+		l_parser.next_token()
+	}
+	return statement
+}
+
+/*
+   Tail Calls
+
+   Recursion is the only way to loop in monna, so a function like
+
+   ```
+   let count = fn(n) { if (n == 0) { return 0; } count(n - 1) };
+   ```
+
+   must not use up a Go stack frame for every iteration. A call is in tail position when its value is
+   returned straight away by the enclosing function: the value of a return statement, or the last
+   expression of the body, following both branches of an if expression. Those calls are marked here so
+   the evaluator can return them to the caller instead of making them, see apply_function.
+*/
+func mark_tail_calls(block *ast.BlockStatement, tail bool) {
+	for index, statement := range block.Statements {
+		last := tail && index == len(block.Statements)-1
+
+		switch statement := statement.(type) {
+		case *ast.ReturnStatement:
+			mark_tail_expression(statement.ReturnValue, true)
+		case *ast.ExpressionStatement:
+			mark_tail_expression(statement.Expression, last)
+		}
+	}
+}
+
+func mark_tail_expression(expression ast.Expression, tail bool) {
+	switch expression := expression.(type) {
+	case *ast.CallExpression:
+		expression.Tail = tail
+	case *ast.IfExpression:
+		mark_tail_calls(expression.Consequence, tail)
+		if expression.Alternative != nil {
+			mark_tail_calls(expression.Alternative, tail)
+		}
+	case *ast.MatchExpression:
+		for _, arm := range expression.Arms {
+			mark_tail_expression(arm.Body, tail)
+		}
+	case *ast.ConditionalExpression:
+		mark_tail_expression(expression.Consequence, tail)
+		mark_tail_expression(expression.Alternative, tail)
+	case *ast.InfixExpression:
+		if expression.Operator == "??" {
+			mark_tail_expression(expression.Right, tail)
+		}
+	}
+}
+
+/*
+   Match Expressions
+
+   ```
+   match (value) {
+       0 => "zero",
+       [first, ...rest] if first > 0 => "a positive head",
+       {name} => "hello " + name,
+       _ => "something else",
+   }
+   ```
+
+   `match` is not a keyword, the regex builtin of that name is called like any other function. It only
+   starts a match expression when the value in parentheses is followed by a `{`, which a call never is.
+*/
+func (l_parser *Parser) parse_match_expression() ast.Expression {
+	identifier := &ast.Identifier{Token: l_parser.current_token, Value: l_parser.current_token.Literal}
+	l_parser.next_token()
+
+	call := &ast.CallExpression{Token: l_parser.current_token, Function: identifier}
+	call.Arguments = l_parser.parse_expression_list(token.RPAREN)
+	if !l_parser.peek_token_is(token.LBRACE) || len(call.Arguments) != 1 {
+		return call
+	}
+
+	expression := &ast.MatchExpression{Token: identifier.Token, Subject: call.Arguments[0]}
+	l_parser.next_token()
+
+	for !l_parser.peek_token_is(token.RBRACE) {
+		l_parser.next_token()
+		arm := ast.MatchArm{Pattern: l_parser.parse_pattern()}
+		if arm.Pattern == nil {
+			return nil
+		}
+
+		if l_parser.peek_token_is(token.IF) {
+			l_parser.next_token()
+			l_parser.next_token()
+			in_guard := l_parser.in_guard
+			l_parser.in_guard = true
+			arm.Guard = l_parser.parse_expression(LOWEST)
+			l_parser.in_guard = in_guard
+		}
+		if !l_parser.expect_peek(token.ARROW) {
+			return nil
+		}
+		l_parser.next_token()
+		arm.Body = l_parser.parse_expression(LOWEST)
+		expression.Arms = append(expression.Arms, arm)
+
+		if !l_parser.peek_token_is(token.RBRACE) && !l_parser.expect_peek(token.COMMA) {
+			return nil
+		}
+	}
+	l_parser.next_token()
+	return expression
+}
+
+// Parses the pattern starting at the current token.
+func (l_parser *Parser) parse_pattern() ast.Pattern {
+	switch l_parser.current_token.Type {
+	case token.IDENT:
+		if l_parser.peek_token_is(token.DOT) || l_parser.peek_token_is(token.LPAREN) {
+			return l_parser.parse_variant_pattern()
+		}
+		if l_parser.current_token.Literal == "_" {
+			return &ast.WildcardPattern{Token: l_parser.current_token}
+		}
+		return &ast.Identifier{Token: l_parser.current_token, Value: l_parser.current_token.Literal}
+
+	case token.INT, token.FLOAT, token.STRING, token.TRUE, token.FALSE:
+		pattern := &ast.LiteralPattern{Token: l_parser.current_token}
+		pattern.Value = l_parser.prefix_parse_functions[l_parser.current_token.Type]()
+		if pattern.Value == nil {
+			return nil
+		}
+		return pattern
+
+	case token.MINUS:
+		pattern := &ast.LiteralPattern{Token: l_parser.current_token}
+		if !l_parser.peek_token_is(token.INT) && !l_parser.peek_token_is(token.FLOAT) {
+			l_parser.pattern_error(l_parser.peek_token)
+			return nil
+		}
+		negative := &ast.PrefixExpression{Token: l_parser.current_token, Operator: "-"}
+		l_parser.next_token()
+		negative.Right = l_parser.prefix_parse_functions[l_parser.current_token.Type]()
+		if negative.Right == nil {
+			return nil
+		}
+		pattern.Value = negative
+		return pattern
+
+	case token.LBRACKET:
+		return l_parser.parse_array_pattern()
+
+	case token.LBRACE:
+		return l_parser.parse_hash_pattern()
+
+	default:
+		l_parser.pattern_error(l_parser.current_token)
+		return nil
+	}
+}
+
+func (l_parser *Parser) pattern_error(l_token token.Token) {
+	message := fmt.Sprintf("unexpected %s in a pattern", l_token.Literal)
+	l_parser.errors = append(l_parser.errors, message)
+}
+
+// [first, second, ...rest], where `...` alone ignores the remaining elements and must come last.
+func (l_parser *Parser) parse_array_pattern() ast.Pattern {
+	pattern := &ast.ArrayPattern{Token: l_parser.current_token}
+
+	for !l_parser.peek_token_is(token.RBRACKET) {
+		l_parser.next_token()
+		if l_parser.current_token_is(token.ELLIPSIS) {
+			pattern.Rest = &ast.WildcardPattern{Token: l_parser.current_token}
+			if l_parser.peek_token_is(token.IDENT) {
+				l_parser.next_token()
+				pattern.Rest = l_parser.parse_pattern()
+			}
+			if !l_parser.expect_peek(token.RBRACKET) {
+				return nil
+			}
+			return pattern
+		}
+
+		element := l_parser.parse_pattern()
+		if element == nil {
+			return nil
+		}
+		pattern.Elements = append(pattern.Elements, element)
+
+		if !l_parser.peek_token_is(token.RBRACKET) && !l_parser.expect_peek(token.COMMA) {
+			return nil
+		}
+	}
+	l_parser.next_token()
+	return pattern
+}
+
+// Ok(value), Result.Ok(value) or Status.Pending.
+func (l_parser *Parser) parse_variant_pattern() ast.Pattern {
+	pattern := &ast.VariantPattern{Token: l_parser.current_token, Variant: l_parser.current_token.Literal}
+	if l_parser.peek_token_is(token.DOT) {
+		l_parser.next_token()
+		if !l_parser.expect_peek(token.IDENT) {
+			return nil
+		}
+		pattern.Enum = &ast.Identifier{Token: pattern.Token, Value: pattern.Variant}
+		pattern.Variant = l_parser.current_token.Literal
+	}
+	if !l_parser.peek_token_is(token.LPAREN) {
+		return pattern
+	}
+	l_parser.next_token()
+
+	pattern.Values = []ast.Pattern{}
+	for !l_parser.peek_token_is(token.RPAREN) {
+		l_parser.next_token()
+		value := l_parser.parse_pattern()
+		if value == nil {
+			return nil
+		}
+		pattern.Values = append(pattern.Values, value)
+
+		if !l_parser.peek_token_is(token.RPAREN) && !l_parser.expect_peek(token.COMMA) {
+			return nil
+		}
+	}
+	l_parser.next_token()
+	return pattern
+}
+
+// {name, "full name": full_name, address: {city}}, a key without a pattern binds a name of its own.
+func (l_parser *Parser) parse_hash_pattern() ast.Pattern {
+	pattern := &ast.HashPattern{Token: l_parser.current_token}
+
+	for !l_parser.peek_token_is(token.RBRACE) {
+		l_parser.next_token()
+		key := l_parser.current_token
+		if !l_parser.current_token_is(token.IDENT) && !l_parser.current_token_is(token.STRING) {
+			l_parser.pattern_error(key)
+			return nil
+		}
+
+		pair := ast.HashPatternPair{Key: key.Literal}
+		switch {
+		case l_parser.peek_token_is(token.COLON):
+			l_parser.next_token()
+			l_parser.next_token()
+			pair.Value = l_parser.parse_pattern()
+			if pair.Value == nil {
+				return nil
+			}
+		case key.Type == token.IDENT:
+			pair.Value = &ast.Identifier{Token: key, Value: key.Literal}
+		default:
+			l_parser.peek_error(token.COLON)
+			return nil
+		}
+		pattern.Pairs = append(pattern.Pairs, pair)
+
+		if !l_parser.peek_token_is(token.RBRACE) && !l_parser.expect_peek(token.COMMA) {
+			return nil
+		}
+	}
+	l_parser.next_token()
+	return pattern
+}
+
 func (l_parser *Parser) parse_function_parameters() []*ast.Identifier {
 	//	defer untrace(trace("parse_function_parameters"))
 	identifiers := []*ast.Identifier{}
@@ -412,30 +1012,106 @@ func (l_parser *Parser) parse_function_parameters() []*ast.Identifier {
 func (l_parser *Parser) parse_call_expression(function ast.Expression) ast.Expression {
 	//	defer untrace(trace("parse_call_expression"))
 	expression := &ast.CallExpression{Token: l_parser.current_token, Function: function}
-	expression.Arguments = l_parser.parse_call_arguments()
+
+	// The arguments of a call inside a guard are between parentheses of their own and can be arrow functions.
+	in_guard := l_parser.in_guard
+	l_parser.in_guard = false
+	expression.Arguments = l_parser.parse_expression_list(token.RPAREN)
+	l_parser.in_guard = in_guard
 	return expression
 }
 
-func (l_parser *Parser) parse_call_arguments() []ast.Expression {
-	//	defer untrace(trace("parse_call_arguments"))
-	args := []ast.Expression{}
+// Parses comma separated expressions up to the end token, i.e. the arguments of a call or the elements of an
+// array.
+func (l_parser *Parser) parse_expression_list(end token.TokenType) []ast.Expression {
+	//	defer untrace(trace("parse_expression_list"))
+	list := []ast.Expression{}
 
-	if l_parser.peek_token_is(token.RPAREN) {
+	if l_parser.peek_token_is(end) {
 		l_parser.next_token()
-		return args
+		return list
 	}
 
 	l_parser.next_token()
-	args = append(args, l_parser.parse_expression(LOWEST))
+	list = append(list, l_parser.parse_expression(LOWEST))
 
 	for l_parser.peek_token_is(token.COMMA) {
 		l_parser.next_token()
 		l_parser.next_token()
-		args = append(args, l_parser.parse_expression(LOWEST))
+		list = append(list, l_parser.parse_expression(LOWEST))
 	}
 
-	if !l_parser.expect_peek(token.RPAREN) {
+	if !l_parser.expect_peek(end) {
+		return nil
+	}
+	return list
+}
+
+func (l_parser *Parser) parse_array_literal() ast.Expression {
+	//	defer untrace(trace("parse_array_literal"))
+	array := &ast.ArrayLiteral{Token: l_parser.current_token}
+
+	// Like the arguments of a call, the elements are between brackets of their own inside a guard.
+	in_guard := l_parser.in_guard
+	l_parser.in_guard = false
+	array.Elements = l_parser.parse_expression_list(token.RBRACKET)
+	l_parser.in_guard = in_guard
+	return array
+}
+
+func (l_parser *Parser) parse_hash_literal() ast.Expression {
+	//	defer untrace(trace("parse_hash_literal"))
+	hash := &ast.HashLiteral{Token: l_parser.current_token, Pairs: []ast.HashLiteralPair{}}
+
+	in_guard := l_parser.in_guard
+	l_parser.in_guard = false
+	defer func() { l_parser.in_guard = in_guard }()
+
+	for !l_parser.peek_token_is(token.RBRACE) {
+		l_parser.next_token()
+		key := l_parser.parse_expression(LOWEST)
+		if !l_parser.expect_peek(token.COLON) {
+			return nil
+		}
+
+		l_parser.next_token()
+		value := l_parser.parse_expression(LOWEST)
+		hash.Pairs = append(hash.Pairs, ast.HashLiteralPair{Key: key, Value: value})
+
+		if !l_parser.peek_token_is(token.RBRACE) && !l_parser.expect_peek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !l_parser.expect_peek(token.RBRACE) {
+		return nil
+	}
+	return hash
+}
+
+func (l_parser *Parser) parse_index_expression(left ast.Expression) ast.Expression {
+	//	defer untrace(trace("parse_index_expression"))
+	expression := &ast.IndexExpression{Token: l_parser.current_token, Left: left}
+
+	in_guard := l_parser.in_guard
+	l_parser.in_guard = false
+	l_parser.next_token()
+	expression.Index = l_parser.parse_expression(LOWEST)
+	l_parser.in_guard = in_guard
+
+	if !l_parser.expect_peek(token.RBRACKET) {
 		return nil
 	}
-	return args
+	return expression
+}
+
+func (l_parser *Parser) parse_member_expression(left ast.Expression) ast.Expression {
+	expression := &ast.MemberExpression{Token: l_parser.current_token, Object: left}
+	expression.Optional = l_parser.current_token_is(token.OPTIONAL_DOT)
+
+	if !l_parser.expect_peek(token.IDENT) {
+		return nil
+	}
+	expression.Member = &ast.Identifier{Token: l_parser.current_token, Value: l_parser.current_token.Literal}
+	return expression
 }
@@ -149,6 +149,7 @@ func TestParsingPrefixExpressions(l_test *testing.T) {
 		{"-15", "-", 15},
 		{"!true;", "!", true},
 		{"!false;", "!", false},
+		{"~15", "~", 15},
 	}
 
 	for _, tt := range prefix_tests {
@@ -195,6 +196,17 @@ func TestParsingInfixExpressions(l_test *testing.T) {
 		{"5 < 5;", 5, "<", 5},
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
+		{"5 <= 5;", 5, "<=", 5},
+		{"5 >= 5;", 5, ">=", 5},
+		{"5 % 5;", 5, "%", 5},
+		{"5 ** 5;", 5, "**", 5},
+		{"5 & 5;", 5, "&", 5},
+		{"5 | 5;", 5, "|", 5},
+		{"5 ^ 5;", 5, "^", 5},
+		{"5 << 5;", 5, "<<", 5},
+		{"5 >> 5;", 5, ">>", 5},
+		{"true && false", true, "&&", false},
+		{"true || false", true, "||", false},
 		{"true == true", true, "==", true},
 		{"true != false", true, "!=", false},
 		{"false == false", false, "==", false},
@@ -322,6 +334,46 @@ func TestOperatorPrecedenceParsing(l_test *testing.T) {
 			"add(a + b + c * d / f + g)",
 			"add((((a + b) + ((c * d) / f)) + g))",
 		},
+		{
+			"a * [1, 2, 3, 4][b * c] * d",
+			"((a * ([1, 2, 3, 4][(b * c)])) * d)",
+		},
+		{
+			"add(a * b[2], b[1], 2 * [1, 2][1])",
+			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
+		},
+		{
+			"-lib.area(2, 3) * lib.sides",
+			"((-(lib.area)(2, 3)) * (lib.sides))",
+		},
+		{
+			"a.b.c[0]",
+			"(((a.b).c)[0])",
+		},
+		{
+			"a ** b ** c",
+			"(a ** (b ** c))",
+		},
+		{
+			"-a ** b * c",
+			"((-(a ** b)) * c)",
+		},
+		{
+			"a | b ^ c & d << e + f % g",
+			"(a | (b ^ (c & (d << (e + (f % g))))))",
+		},
+		{
+			"~a & b == c",
+			"(((~a) & b) == c)",
+		},
+		{
+			"a || b && c == d",
+			"(a || (b && (c == d)))",
+		},
+		{
+			"a <= b + 1 && c >= d || !e",
+			"(((a <= (b + 1)) && (c >= d)) || (!e))",
+		},
 	}
 	for _, tt := range tests {
 		l_lexer := lexer.New(tt.input)
@@ -505,6 +557,88 @@ func TestFunctionLiteralParsing(l_test *testing.T) {
 
 }
 
+func TestArrowFunctionParsing(l_test *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x => x * 2", "fn(x) (x * 2)"},
+		{"(a, b) => a + b", "fn(a, b) (a + b)"},
+		{"() => 42", "fn() 42"},
+		{"(x) => { let y = x; y }", "fn(x) let y = x;y"},
+		{"map(xs, x => x + 1)", "map(xs, fn(x) (x + 1))"},
+		{"reduce(xs, (a, b) => a + b, 0)", "reduce(xs, fn(a, b) (a + b), 0)"},
+		{"a => b => a + b", "fn(a) fn(b) (a + b)"},
+		{"(a + b) * c", "((a + b) * c)"},
+		{"match (x) { n if n => n => n }", "match (x) { n if n => fn(n) n }"},
+		{"match (x) { n if (n) => n }", "match (x) { n if n => n }"},
+		{"match (x) { n if any(xs, x => x == n) => n }", "match (x) { n if any(xs, fn(x) (x == n)) => n }"},
+	}
+	for _, tt := range tests {
+		l_parser := New(lexer.New(tt.input))
+		program := l_parser.ParseProgram()
+		check_parser_errors(l_test, l_parser)
+
+		if actual := program.String(); actual != tt.expected {
+			l_test.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+
+	l_parser := New(lexer.New("(a, b) => a"))
+	program := l_parser.ParseProgram()
+	check_parser_errors(l_test, l_parser)
+	function, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if !ok {
+		l_test.Fatalf("expression is not ast.FunctionLiteral, got=%T", program.Statements[0])
+	}
+	testLiteralExpression(l_test, function.Parameters[0], "a")
+	testLiteralExpression(l_test, function.Parameters[1], "b")
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"(a, 1) => a", "expected a parameter name, got 1"},
+		{"(a, b)", "expected => after the parameters of an arrow function, got "},
+		{"()", "expected => after the parameters of an arrow function, got "},
+		{"x =>", "no prefix parse function for EOF, found"},
+	}
+	for _, tt := range errors {
+		l_parser := New(lexer.New(tt.input))
+		l_parser.ParseProgram()
+		if len(l_parser.Errors()) == 0 || l_parser.Errors()[0] != tt.expected {
+			l_test.Errorf("%s: expected error %q, got=%v", tt.input, tt.expected, l_parser.Errors())
+		}
+	}
+}
+
+func TestFunctionStatements(l_test *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn add(a, b) { a + b }", "fn add(a, b) (a + b)"},
+		{"fn add(a, b) { a + b }; add(1, 2)", "fn add(a, b) (a + b)add(1, 2)"},
+		{"export fn id(x) { x }", "export fn id(x) x"},
+		{"fn(x) { x }(1)", "fn(x) x(1)"},
+	}
+	for _, tt := range tests {
+		l_parser := New(lexer.New(tt.input))
+		program := l_parser.ParseProgram()
+		check_parser_errors(l_test, l_parser)
+
+		if actual := program.String(); actual != tt.expected {
+			l_test.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+
+	l_parser := New(lexer.New("export fn (x) { x }"))
+	l_parser.ParseProgram()
+	if len(l_parser.Errors()) == 0 || l_parser.Errors()[0] != "expected next token to be IDENT, got (" {
+		l_test.Errorf("expected an error for a missing name, got=%v", l_parser.Errors())
+	}
+}
+
 func TestFunctionParameterParsing(l_test *testing.T) {
 	tests := []struct {
 		input           string
@@ -658,6 +792,44 @@ func TestLetStatements(l_test *testing.T) {
 	}
 }
 
+func TestDestructuringLetStatements(l_test *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let [a, b, ...rest] = arr;", "let [a, b, ...rest] = arr;"},
+		{"let [_, [x, y]] = pairs", "let [_, [x, y]] = pairs;"},
+		{"let {name, age} = person;", `let {"name": name, "age": age} = person;`},
+		{`let {"full name": full, address: {city}} = person;`, `let {"full name": full, "address": {"city": city}} = person;`},
+	}
+
+	for _, tt := range tests {
+		l_parser := New(lexer.New(tt.input))
+		program := l_parser.ParseProgram()
+		check_parser_errors(l_test, l_parser)
+
+		if actual := program.String(); actual != tt.expected {
+			l_test.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"let 5 = x;", "expected next token to be IDENT, got INT"},
+		{"let [a, 1 + 1] = x;", "expected next token to be ,, got +"},
+		{"let {a} x;", "expected next token to be =, got IDENT"},
+	}
+	for _, tt := range errors {
+		l_parser := New(lexer.New(tt.input))
+		l_parser.ParseProgram()
+		if len(l_parser.Errors()) == 0 || l_parser.Errors()[0] != tt.expected {
+			l_test.Errorf("%s: expected error %q, got=%v", tt.input, tt.expected, l_parser.Errors())
+		}
+	}
+}
+
 func TestStringLiteralExpression(l_test *testing.T) {
 	input := `"Hello world";`
 
@@ -677,8 +849,413 @@ func TestStringLiteralExpression(l_test *testing.T) {
 	}
 }
 
+func TestFloatLiteralExpression(l_test *testing.T) {
+	input := "3.25;"
+
+	l_parser := New(lexer.New(input))
+	program := l_parser.ParseProgram()
+	check_parser_errors(l_test, l_parser)
+
+	statement := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := statement.Expression.(*ast.FloatLiteral)
+	if !ok {
+		l_test.Fatalf("expression not *ast.FloatLiteral, got=%T", statement.Expression)
+	}
+
+	if literal.Value != 3.25 {
+		l_test.Errorf("literal.Value not %f, got=%f", 3.25, literal.Value)
+	}
+	if literal.TokenLiteral() != "3.25" {
+		l_test.Errorf("literal.TokenLiteral not %q, got=%q", "3.25", literal.TokenLiteral())
+	}
+}
+
 // Helpers
 
+func TestParsingArrayLiterals(l_test *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	l_parser := New(lexer.New(input))
+	program := l_parser.ParseProgram()
+	check_parser_errors(l_test, l_parser)
+
+	statement, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		l_test.Fatalf("statement is not ast.ExpressionStatement, got=%T", program.Statements[0])
+	}
+	array, ok := statement.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		l_test.Fatalf("expression is not ast.ArrayLiteral, got=%T", statement.Expression)
+	}
+
+	if len(array.Elements) != 3 {
+		l_test.Fatalf("len(array.Elements) not 3, got=%d", len(array.Elements))
+	}
+	testIntegerLiteral(l_test, array.Elements[0], 1)
+	testInfixExpression(l_test, array.Elements[1], 2, "*", 2)
+	testInfixExpression(l_test, array.Elements[2], 3, "+", 3)
+}
+
+func TestParsingHashLiterals(l_test *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"one": 1, "two": 2 * 2}`, `{one: 1, two: (2 * 2)}`},
+		{`{}`, `{}`},
+		{`{true: 1, 2: "two", key: value}`, `{true: 1, 2: two, key: value}`},
+	}
+
+	for _, tt := range tests {
+		l_parser := New(lexer.New(tt.input))
+		program := l_parser.ParseProgram()
+		check_parser_errors(l_test, l_parser)
+
+		statement := program.Statements[0].(*ast.ExpressionStatement)
+		hash, ok := statement.Expression.(*ast.HashLiteral)
+		if !ok {
+			l_test.Fatalf("expression is not ast.HashLiteral, got=%T", statement.Expression)
+		}
+		if hash.String() != tt.expected {
+			l_test.Errorf("expected=%q, got=%q", tt.expected, hash.String())
+		}
+	}
+}
+
+func TestParsingIndexExpressions(l_test *testing.T) {
+	input := "my_array[1 + 1]"
+
+	l_parser := New(lexer.New(input))
+	program := l_parser.ParseProgram()
+	check_parser_errors(l_test, l_parser)
+
+	statement, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		l_test.Fatalf("statement is not ast.ExpressionStatement, got=%T", program.Statements[0])
+	}
+	index, ok := statement.Expression.(*ast.IndexExpression)
+	if !ok {
+		l_test.Fatalf("expression is not ast.IndexExpression, got=%T", statement.Expression)
+	}
+
+	if !testIdentifier(l_test, index.Left, "my_array") {
+		return
+	}
+	testInfixExpression(l_test, index.Index, 1, "+", 1)
+}
+
+func TestImportAndExportStatements(l_test *testing.T) {
+	input := `import "lib/geometry.mn" as geometry; export let area = geometry.area;`
+
+	l_parser := New(lexer.New(input))
+	program := l_parser.ParseProgram()
+	check_parser_errors(l_test, l_parser)
+
+	if len(program.Statements) != 2 {
+		l_test.Fatalf("program has wrong number of statements, got=%d", len(program.Statements))
+	}
+	import_statement, ok := program.Statements[0].(*ast.ImportStatement)
+	if !ok {
+		l_test.Fatalf("statement is not ast.ImportStatement, got=%T", program.Statements[0])
+	}
+	if import_statement.Path != "lib/geometry.mn" || import_statement.Name.Value != "geometry" {
+		l_test.Errorf("wrong import, got=%s", import_statement)
+	}
+	export_statement, ok := program.Statements[1].(*ast.ExportStatement)
+	if !ok {
+		l_test.Fatalf("statement is not ast.ExportStatement, got=%T", program.Statements[1])
+	}
+	if !testLetStatement(l_test, export_statement.Statement, "area") {
+		return
+	}
+	if actual := program.String(); actual != `import "lib/geometry.mn" as geometry;export let area = (geometry.area);` {
+		l_test.Errorf("wrong program, got=%q", actual)
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`import "lib.mn" lib;`, "expected as after the import path, got lib"},
+		{`import lib as lib;`, "expected next token to be STRING, got IDENT"},
+		{`export 5;`, "expected a declaration after export, got 5"},
+	}
+	for _, tt := range errors {
+		l_parser := New(lexer.New(tt.input))
+		l_parser.ParseProgram()
+		if len(l_parser.Errors()) == 0 || l_parser.Errors()[0] != tt.expected {
+			l_test.Errorf("%s: expected error %q, got=%v", tt.input, tt.expected, l_parser.Errors())
+		}
+	}
+}
+
+func TestStructStatements(l_test *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"struct Point { x, y };", "struct Point { x, y }"},
+		{"struct Empty {}", "struct Empty {}"},
+		{"struct Person {\n name,\n age,\n} Person", "struct Person { name, age }Person"},
+		{"export struct Point { x, y }", "export struct Point { x, y }"},
+	}
+	for _, tt := range tests {
+		l_parser := New(lexer.New(tt.input))
+		program := l_parser.ParseProgram()
+		check_parser_errors(l_test, l_parser)
+
+		if actual := program.String(); actual != tt.expected {
+			l_test.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"struct { x }", "expected next token to be IDENT, got {"},
+		{"struct Point x, y", "expected next token to be {, got IDENT"},
+		{"struct Point { x y }", "expected next token to be ,, got IDENT"},
+		{`struct Point { "x" }`, "expected next token to be IDENT, got STRING"},
+		{"struct Point { x, y, x }", "duplicate field x in struct Point"},
+	}
+	for _, tt := range errors {
+		l_parser := New(lexer.New(tt.input))
+		l_parser.ParseProgram()
+		if len(l_parser.Errors()) == 0 || l_parser.Errors()[0] != tt.expected {
+			l_test.Errorf("%s: expected error %q, got=%v", tt.input, tt.expected, l_parser.Errors())
+		}
+	}
+}
+
+func TestConditionalAndNullSafeExpressions(l_test *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a ? b : c", "(a ? b : c)"},
+		{"a > 1 ? b + 1 : c * 2", "((a > 1) ? (b + 1) : (c * 2))"},
+		{"a ? b : c ? d : e", "(a ? b : (c ? d : e))"},
+		{"a ? b ? c : d : e", "(a ? (b ? c : d) : e)"},
+		{"a || b ? c : d", "((a || b) ? c : d)"},
+		{"a ?? b ?? c", "((a ?? b) ?? c)"},
+		{"a ?? b || c", "(a ?? (b || c))"},
+		{"a ?? b ? c : d", "((a ?? b) ? c : d)"},
+		{"a?.b", "(a?.b)"},
+		{"a?.b.c?.d(1)", "(((a?.b).c)?.d)(1)"},
+		{"-a?.b ?? 0", "((-(a?.b)) ?? 0)"},
+		{`{"k": a ? 1 : 2}`, "{k: (a ? 1 : 2)}"},
+		{"f(a ? x => x : y => 0)", "f((a ? fn(x) x : fn(y) 0))"},
+	}
+	for _, tt := range tests {
+		l_parser := New(lexer.New(tt.input))
+		program := l_parser.ParseProgram()
+		check_parser_errors(l_test, l_parser)
+
+		if actual := program.String(); actual != tt.expected {
+			l_test.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"a ? b", "expected next token to be :, got EOF"},
+		{"a ? b c", "expected next token to be :, got IDENT"},
+		{"a?.1", "expected next token to be IDENT, got INT"},
+	}
+	for _, tt := range errors {
+		l_parser := New(lexer.New(tt.input))
+		l_parser.ParseProgram()
+		if len(l_parser.Errors()) == 0 || l_parser.Errors()[0] != tt.expected {
+			l_test.Errorf("%s: expected error %q, got=%v", tt.input, tt.expected, l_parser.Errors())
+		}
+	}
+}
+
+func TestEnumStatements(l_test *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"enum Result { Ok(value), Err(error) };", "enum Result { Ok(value), Err(error) }"},
+		{"enum Status {\n Pending,\n Done(result),\n}", "enum Status { Pending, Done(result) }"},
+		{"enum Unit { Only() }", "enum Unit { Only }"},
+		{"export enum Result { Ok(value) }", "export enum Result { Ok(value) }"},
+		{"r is Result.Ok == true", "((r is (Result.Ok)) == true)"},
+		{"!r is Result && ok", "(((!r) is Result) && ok)"},
+		{"match (r) { Ok(v) => v, Result.Err(_) => 0, Status.Pending => 1, Status.Done => 2, Pair(1, [x]) => x }", "match (r) { Ok(v) => v, Result.Err(_) => 0, Status.Pending => 1, Status.Done => 2, Pair(1, [x]) => x }"},
+	}
+	for _, tt := range tests {
+		l_parser := New(lexer.New(tt.input))
+		program := l_parser.ParseProgram()
+		check_parser_errors(l_test, l_parser)
+
+		if actual := program.String(); actual != tt.expected {
+			l_test.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"enum { A }", "expected next token to be IDENT, got {"},
+		{"enum E { A B }", "expected next token to be ,, got IDENT"},
+		{"enum E { A, B, A }", "duplicate variant A in enum E"},
+		{"enum E { A(x, x) }", "duplicate field x in variant A"},
+		{"match (r) { E.(x) => x }", "expected next token to be IDENT, got ("},
+		{"match (r) { Ok(x y) => x }", "expected next token to be ,, got IDENT"},
+	}
+	for _, tt := range errors {
+		l_parser := New(lexer.New(tt.input))
+		l_parser.ParseProgram()
+		if len(l_parser.Errors()) == 0 || l_parser.Errors()[0] != tt.expected {
+			l_test.Errorf("%s: expected error %q, got=%v", tt.input, tt.expected, l_parser.Errors())
+		}
+	}
+}
+
+func TestMatchExpressionParsing(l_test *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`match (x) { 0 => "zero", -1.5 => "negative", _ => "other" }`,
+			`match (x) { 0 => zero, (-1.5) => negative, _ => other }`,
+		},
+		{
+			`match (point) { [x, y, ...rest] if x > y => x, [...] => 0, }`,
+			`match (point) { [x, y, ...rest] if (x > y) => x, [..._] => 0 }`,
+		},
+		{
+			`match (person) { {name, "full name": full, address: {city}} => city }`,
+			`match (person) { {"name": name, "full name": full, "address": {"city": city}} => city }`,
+		},
+		{
+			`match(re, s)`,
+			`match(re, s)`,
+		},
+		{
+			`match(s).len()`,
+			`(match(s).len)()`,
+		},
+		{
+			`match (x) { x if [y => y][0](x) == 1 => x }`,
+			`match (x) { x if (([fn(y) y][0])(x) == 1) => x }`,
+		},
+		{
+			`match (x) { x if {"f": y => y}["f"](x) == 1 => x }`,
+			`match (x) { x if (({f: fn(y) y}[f])(x) == 1) => x }`,
+		},
+		{
+			`match (x) { x if [1, 2][(y => y)(x)] == 2 => x }`,
+			`match (x) { x if (([1, 2][fn(y) y(x)]) == 2) => x }`,
+		},
+	}
+	for _, tt := range tests {
+		l_parser := New(lexer.New(tt.input))
+		program := l_parser.ParseProgram()
+		check_parser_errors(l_test, l_parser)
+
+		if actual := program.String(); actual != tt.expected {
+			l_test.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+
+	l_parser := New(lexer.New(`match (x) { [a] if a => a }`))
+	program := l_parser.ParseProgram()
+	check_parser_errors(l_test, l_parser)
+
+	statement, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		l_test.Fatalf("statement is not ast.ExpressionStatement, got=%T", program.Statements[0])
+	}
+	match, ok := statement.Expression.(*ast.MatchExpression)
+	if !ok {
+		l_test.Fatalf("expression is not ast.MatchExpression, got=%T", statement.Expression)
+	}
+	if len(match.Arms) != 1 || match.Arms[0].Guard == nil {
+		l_test.Fatalf("expected one arm with a guard, got=%+v", match.Arms)
+	}
+	if _, ok := match.Arms[0].Pattern.(*ast.ArrayPattern); !ok {
+		l_test.Errorf("pattern is not ast.ArrayPattern, got=%T", match.Arms[0].Pattern)
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`match (x) { x + 1 => 1 }`, "expected next token to be =>, got +"},
+		{`match (x) { [...rest, last] => 1 }`, "expected next token to be ], got ,"},
+		{`match (x) { fn => 1 }`, "unexpected fn in a pattern"},
+		{`match (x) { {"key"} => 1 }`, "expected next token to be :, got }"},
+		{`match (x) { 1 => 1 2 => 2 }`, "expected next token to be ,, got INT"},
+	}
+	for _, tt := range errors {
+		l_parser := New(lexer.New(tt.input))
+		l_parser.ParseProgram()
+		if len(l_parser.Errors()) == 0 || l_parser.Errors()[0] != tt.expected {
+			l_test.Errorf("%s: expected error %q, got=%v", tt.input, tt.expected, l_parser.Errors())
+		}
+	}
+}
+
+func TestTailCallMarking(l_test *testing.T) {
+	input := `
+   fn(n) {
+     if (n == 0) { return f(n); }
+     g(n);
+     let x = h(n);
+     if (n > 1) { i(n) } else { j(n) }
+   }
+  `
+
+	l_parser := New(lexer.New(input))
+	program := l_parser.ParseProgram()
+	check_parser_errors(l_test, l_parser)
+
+	function := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	calls := map[string]bool{}
+	collect_calls(function.Body, calls)
+
+	expected := map[string]bool{"f": true, "g": false, "h": false, "i": true, "j": true}
+	for name, tail := range expected {
+		got, ok := calls[name]
+		if !ok {
+			l_test.Errorf("call to %s not found", name)
+			continue
+		}
+		if got != tail {
+			l_test.Errorf("call to %s has Tail=%t, want=%t", name, got, tail)
+		}
+	}
+}
+
+func collect_calls(node ast.Node, calls map[string]bool) {
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		for _, statement := range node.Statements {
+			collect_calls(statement, calls)
+		}
+	case *ast.ExpressionStatement:
+		collect_calls(node.Expression, calls)
+	case *ast.ReturnStatement:
+		collect_calls(node.ReturnValue, calls)
+	case *ast.LetStatement:
+		collect_calls(node.Value, calls)
+	case *ast.IfExpression:
+		collect_calls(node.Consequence, calls)
+		if node.Alternative != nil {
+			collect_calls(node.Alternative, calls)
+		}
+	case *ast.CallExpression:
+		calls[node.Function.String()] = node.Tail
+	}
+}
+
 func check_parser_errors(l_test *testing.T, l_parser *Parser) {
 	errors := l_parser.Errors()
 	if len(errors) == 0 {
@@ -705,13 +1282,19 @@ func testLetStatement(l_test *testing.T, statement ast.Statement, name string) b
 		return false
 	}
 
-	if let_statement.Name.Value != name {
-		l_test.Errorf("let_statement.name.Value not %s, got=%s", name, let_statement.Name.Value)
+	identifier, ok := let_statement.Name.(*ast.Identifier)
+	if !ok {
+		l_test.Errorf("let_statement.Name not *ast.Identifier, got=%T", let_statement.Name)
+		return false
+	}
+
+	if identifier.Value != name {
+		l_test.Errorf("let_statement.name.Value not %s, got=%s", name, identifier.Value)
 		return false
 	}
 
-	if let_statement.Name.TokenLiteral() != name {
-		l_test.Errorf("let_statement.name.TokenLiteral() not %s, got=%s", name, let_statement.Name.TokenLiteral())
+	if identifier.TokenLiteral() != name {
+		l_test.Errorf("let_statement.name.TokenLiteral() not %s, got=%s", name, identifier.TokenLiteral())
 		return false
 
 	}
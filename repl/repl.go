@@ -8,6 +8,8 @@ import (
 	"monna/lexer"
 	"monna/object"
 	"monna/parser"
+	"monna/resolver"
+	"os"
 )
 
 const MONKEY_FACE = `            __,__
@@ -26,17 +28,25 @@ const MONKEY_FACE = `            __,__
 const PROMPT = ">> "
 
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
+	reader := bufio.NewReader(in)
 	env := object.NewEnvironment()
+	l_evaluator := evaluator.New()
+	l_evaluator.Stdout = out
+	l_evaluator.Stderr = out
+	l_evaluator.Stdin = reader // scripts read the lines after the one being evaluated
+	if directory, err := os.Getwd(); err == nil {
+		l_evaluator.Files = object.FileAccess{Roots: []string{directory}}
+		l_evaluator.Modules.SearchPaths = []string{directory}
+	}
+	l_resolver := resolver.New(l_evaluator.Builtins.Has)
 
 	for {
 		fmt.Fprintf(out, PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
 			return
 		}
 
-		line := scanner.Text()
 		l_lexer := lexer.New(line)
 		l_parser := parser.New(l_lexer)
 		program := l_parser.ParseProgram()
@@ -46,7 +56,16 @@ func Start(in io.Reader, out io.Writer) {
 			continue
 		}
 
-		evaluated := evaluator.Eval(program, env)
+		l_resolver.Resolve(program)
+		for _, message := range l_resolver.Warnings() {
+			io.WriteString(out, "warning: "+message+"\n")
+		}
+		if len(l_resolver.Errors()) != 0 {
+			print_resolver_errors(out, l_resolver.Errors())
+			continue
+		}
+
+		evaluated := l_evaluator.Eval(program, env)
 		if evaluated != nil {
 			io.WriteString(out, evaluated.Inspect())
 			io.WriteString(out, "\n")
@@ -62,3 +81,12 @@ func print_parser_errors(out io.Writer, errors []string) {
 		io.WriteString(out, "\t"+message+"\n")
 	}
 }
+
+func print_resolver_errors(out io.Writer, errors []string) {
+	io.WriteString(out, MONKEY_FACE)
+	io.WriteString(out, "Woops! I ran into some monkey business here!\n")
+	io.WriteString(out, " resolver errors:\n")
+	for _, message := range errors {
+		io.WriteString(out, "\t"+message+"\n")
+	}
+}
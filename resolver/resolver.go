@@ -0,0 +1,350 @@
+/*
+   Resolver
+
+   The evaluator only finds out that a name is undefined when it reaches it, which can be long after other
+   statements have already printed things or called functions. The resolver is a pass that runs between the
+   parser and the evaluator, it walks the program once and works out where every identifier is declared.
+
+   Scopes in monna are function scopes, an `if` block does not introduce a new environment so it does not
+   introduce a new scope either. The one exception is a match arm, it has a scope for what its pattern
+   binds, so that doesn't overwrite the names around the match. The outermost scope is the global scope, it is kept between calls to Resolve
+   so a REPL can resolve one line at a time.
+
+   For every identifier the resolver records two numbers on the ast.Identifier:
+
+   - Depth: how many function scopes there are between the use of the name and its declaration.
+   - Slot:  the position of the binding in the declaring scope, in order of declaration.
+
+   Globals and builtins are given a Slot of -1, they stay dynamic so the REPL can keep adding to them.
+
+   Function bodies are resolved after the scope they are defined in is complete. That way a function can
+   refer to itself, or to a function declared further down, since by the time it is called both exist:
+
+   ```
+   let is_even = fn(n) { if (n == 0) { true } else { is_odd(n - 1) } };
+   let is_odd = fn(n) { if (n == 0) { false } else { is_even(n - 1) } };
+   ```
+*/
+
+package resolver
+
+import (
+	"fmt"
+	"monna/ast"
+)
+
+type scope struct {
+	outer     *scope
+	slots     map[string]int
+	count     int
+	functions []*ast.FunctionLiteral // bodies waiting for this scope to be complete
+	arms      []*scope               // match arms whose functions wait for this scope as well
+}
+
+func new_scope(outer *scope) *scope {
+	return &scope{outer: outer, slots: make(map[string]int)}
+}
+
+type Resolver struct {
+	global  *scope
+	current *scope
+	builtin func(name string) bool
+
+	errors   []string
+	warnings []string
+}
+
+// New creates a resolver, builtin reports whether a name that isn't declared anywhere is a builtin. It is
+// asked every time so builtins registered after the resolver was created are found too.
+func New(builtin func(name string) bool) *Resolver {
+	global := new_scope(nil)
+	return &Resolver{global: global, current: global, builtin: builtin}
+}
+
+// Errors are problems that would make the program fail at runtime, i.e. undefined identifiers.
+func (l_resolver *Resolver) Errors() []string {
+	return l_resolver.errors
+}
+
+// Warnings are suspicious but valid code, i.e. a parameter shadowing an outer binding.
+func (l_resolver *Resolver) Warnings() []string {
+	return l_resolver.warnings
+}
+
+// Declare adds a global that is defined outside of any program, i.e. set by the host.
+func (l_resolver *Resolver) Declare(name string) {
+	if _, ok := l_resolver.global.slots[name]; !ok {
+		l_resolver.global.slots[name] = l_resolver.global.count
+		l_resolver.global.count += 1
+	}
+}
+
+// Resolve annotates the identifiers of the program. Errors and warnings from previous calls are cleared,
+// global declarations are kept. A program with errors is never run, so the globals it declared are taken
+// back out and later programs don't resolve against them.
+func (l_resolver *Resolver) Resolve(program *ast.Program) {
+	l_resolver.errors = []string{}
+	l_resolver.warnings = []string{}
+	l_resolver.current = l_resolver.global
+
+	slots := make(map[string]int, len(l_resolver.global.slots))
+	for name, slot := range l_resolver.global.slots {
+		slots[name] = slot
+	}
+	count := l_resolver.global.count
+
+	for _, statement := range program.Statements {
+		// Only the statements of the program itself may be exported, not those of an if block or a function.
+		if export, ok := statement.(*ast.ExportStatement); ok {
+			l_resolver.resolve(export.Statement)
+			continue
+		}
+		l_resolver.resolve(statement)
+	}
+	l_resolver.resolve_functions(l_resolver.global)
+
+	if len(l_resolver.errors) > 0 {
+		l_resolver.global.slots = slots
+		l_resolver.global.count = count
+	}
+}
+
+func (l_resolver *Resolver) resolve(node ast.Node) {
+	switch node := node.(type) {
+	// Statements
+	case *ast.BlockStatement:
+		for _, statement := range node.Statements {
+			l_resolver.resolve(statement)
+		}
+
+	case *ast.ExpressionStatement:
+		l_resolver.resolve(node.Expression)
+
+	case *ast.ReturnStatement:
+		l_resolver.resolve(node.ReturnValue)
+
+	case *ast.LetStatement:
+		l_resolver.resolve(node.Value)
+		l_resolver.resolve_pattern(node.Name)
+		l_resolver.declare_pattern(node.Name)
+
+	case *ast.ImportStatement:
+		l_resolver.declare(node.Name)
+
+	case *ast.StructStatement:
+		l_resolver.declare(node.Name)
+
+	case *ast.EnumStatement:
+		l_resolver.declare(node.Name)
+
+	case *ast.FunctionStatement:
+		l_resolver.declare(node.Name)
+		l_resolver.resolve(node.Function)
+
+	case *ast.ExportStatement:
+		l_resolver.errors = append(l_resolver.errors, "export is only allowed at the top level of a module")
+		l_resolver.resolve(node.Statement)
+
+		// Expressions
+	case *ast.Identifier:
+		l_resolver.resolve_identifier(node)
+
+	case *ast.PrefixExpression:
+		l_resolver.resolve(node.Right)
+
+	case *ast.InfixExpression:
+		l_resolver.resolve(node.Left)
+		l_resolver.resolve(node.Right)
+
+	case *ast.IfExpression:
+		l_resolver.resolve(node.Condition)
+		l_resolver.resolve(node.Consequence)
+		if node.Alternative != nil {
+			l_resolver.resolve(node.Alternative)
+		}
+
+	case *ast.ConditionalExpression:
+		l_resolver.resolve(node.Condition)
+		l_resolver.resolve(node.Consequence)
+		l_resolver.resolve(node.Alternative)
+
+	case *ast.FunctionLiteral:
+		l_resolver.current.functions = append(l_resolver.current.functions, node)
+
+	case *ast.CallExpression:
+		l_resolver.resolve(node.Function)
+		for _, argument := range node.Arguments {
+			l_resolver.resolve(argument)
+		}
+
+	case *ast.ArrayLiteral:
+		for _, element := range node.Elements {
+			l_resolver.resolve(element)
+		}
+
+	case *ast.IndexExpression:
+		l_resolver.resolve(node.Left)
+		l_resolver.resolve(node.Index)
+
+	case *ast.HashLiteral:
+		for _, pair := range node.Pairs {
+			l_resolver.resolve(pair.Key)
+			l_resolver.resolve(pair.Value)
+		}
+
+	case *ast.MemberExpression:
+		l_resolver.resolve(node.Object)
+
+	case *ast.MatchExpression:
+		l_resolver.resolve(node.Subject)
+		for i := range node.Arms {
+			arm := &node.Arms[i]
+			l_resolver.resolve_pattern(arm.Pattern)
+			enclosing := l_resolver.current
+			l_resolver.current = new_scope(enclosing)
+
+			l_resolver.declare_pattern(arm.Pattern)
+			if arm.Guard != nil {
+				l_resolver.resolve(arm.Guard)
+			}
+			l_resolver.resolve(arm.Body)
+
+			arm.Resolved = true
+			arm.Slots = l_resolver.current.count
+			enclosing.arms = append(enclosing.arms, l_resolver.current)
+			l_resolver.current = enclosing
+		}
+	}
+}
+
+// Resolves the enums a pattern names, in the scope the value is matched in rather than the one the
+// pattern's bindings go into.
+func (l_resolver *Resolver) resolve_pattern(pattern ast.Pattern) {
+	switch pattern := pattern.(type) {
+	case *ast.ArrayPattern:
+		for _, element := range pattern.Elements {
+			l_resolver.resolve_pattern(element)
+		}
+
+	case *ast.HashPattern:
+		for _, pair := range pattern.Pairs {
+			l_resolver.resolve_pattern(pair.Value)
+		}
+
+	case *ast.VariantPattern:
+		if pattern.Enum != nil {
+			l_resolver.resolve_identifier(pattern.Enum)
+		}
+		for _, value := range pattern.Values {
+			l_resolver.resolve_pattern(value)
+		}
+	}
+}
+
+// Declares every name a pattern binds.
+func (l_resolver *Resolver) declare_pattern(pattern ast.Pattern) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		l_resolver.declare(pattern)
+
+	case *ast.ArrayPattern:
+		for _, element := range pattern.Elements {
+			l_resolver.declare_pattern(element)
+		}
+		if pattern.Rest != nil {
+			l_resolver.declare_pattern(pattern.Rest)
+		}
+
+	case *ast.HashPattern:
+		for _, pair := range pattern.Pairs {
+			l_resolver.declare_pattern(pair.Value)
+		}
+
+	case *ast.VariantPattern:
+		for _, value := range pattern.Values {
+			l_resolver.declare_pattern(value)
+		}
+	}
+}
+
+// Resolves the bodies of the function literals found in a scope, now that every name in it is known.
+func (l_resolver *Resolver) resolve_functions(l_scope *scope) {
+	for len(l_scope.functions) > 0 {
+		function := l_scope.functions[0]
+		l_scope.functions = l_scope.functions[1:]
+
+		enclosing := l_resolver.current
+		l_resolver.current = new_scope(l_scope)
+
+		for _, param := range function.Parameters {
+			l_resolver.declare(param)
+		}
+		l_resolver.resolve(function.Body)
+		l_resolver.resolve_functions(l_resolver.current)
+
+		function.Resolved = true
+		function.Slots = l_resolver.current.count
+
+		l_resolver.current = enclosing
+	}
+
+	for len(l_scope.arms) > 0 {
+		arm := l_scope.arms[0]
+		l_scope.arms = l_scope.arms[1:]
+		l_resolver.resolve_functions(arm)
+	}
+}
+
+func (l_resolver *Resolver) declare(ident *ast.Identifier) {
+	l_scope := l_resolver.current
+
+	slot, ok := l_scope.slots[ident.Value]
+	if !ok {
+		if l_scope != l_resolver.global && l_resolver.lookup(l_scope.outer, ident.Value) {
+			l_resolver.warnings = append(l_resolver.warnings, fmt.Sprintf("declaration of %s shadows an outer binding", ident.Value))
+		}
+		slot = l_scope.count
+		l_scope.slots[ident.Value] = slot
+		l_scope.count += 1
+	}
+
+	ident.Resolved = true
+	ident.Depth = 0
+	ident.Slot = slot
+	if l_scope == l_resolver.global {
+		ident.Slot = -1
+	}
+}
+
+func (l_resolver *Resolver) lookup(l_scope *scope, name string) bool {
+	for ; l_scope != nil; l_scope = l_scope.outer {
+		if _, ok := l_scope.slots[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (l_resolver *Resolver) resolve_identifier(ident *ast.Identifier) {
+	depth := 0
+	for l_scope := l_resolver.current; l_scope != nil; l_scope = l_scope.outer {
+		if slot, ok := l_scope.slots[ident.Value]; ok {
+			ident.Resolved = true
+			ident.Depth = depth
+			ident.Slot = slot
+			if l_scope == l_resolver.global {
+				ident.Slot = -1
+			}
+			return
+		}
+		if l_scope.outer == nil && l_resolver.builtin(ident.Value) {
+			ident.Resolved = true
+			ident.Depth = depth
+			ident.Slot = -1
+			return
+		}
+		depth += 1
+	}
+
+	l_resolver.errors = append(l_resolver.errors, "identifier not found: "+ident.Value)
+}
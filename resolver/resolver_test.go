@@ -0,0 +1,171 @@
+package resolver
+
+import (
+	"monna/ast"
+	"monna/lexer"
+	"monna/parser"
+	"testing"
+)
+
+func TestUndefinedIdentifiers(l_test *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let a = 5; a;", []string{}},
+		{"foobar;", []string{"identifier not found: foobar"}},
+		{"puts(x); let x = 5;", []string{"identifier not found: x"}},
+		{"let x = x + 1;", []string{"identifier not found: x"}},
+		{"let f = fn(a) { a + b };", []string{"identifier not found: b"}},
+		{"let f = fn() { g() }; let g = fn() { 1 };", []string{}},
+		{"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };", []string{}},
+		{"if (true) { let y = 1; } y;", []string{}},
+		{`len("four"); puts(1);`, []string{}},
+		{"let a = [1, 2]; a[i];", []string{"identifier not found: i"}},
+		{`import "lib.mn" as lib; lib.area(w);`, []string{"identifier not found: w"}},
+		{"export let x = 1; let f = fn() { export let y = x; };", []string{"export is only allowed at the top level of a module"}},
+		{"if (true) { export let y = 1; } y;", []string{"export is only allowed at the top level of a module"}},
+		{"let [a, {b}] = [1, {\"b\": 2}]; a + b;", []string{}},
+		{"let [a, ...rest] = rest;", []string{"identifier not found: rest"}},
+		{"let f = fn() { Point(1, 2) }; struct Point { x, y };", []string{}},
+		{"let f = fn() { struct Local { x }; Local(1) }; Local;", []string{"identifier not found: Local"}},
+		{"enum Result { Ok(value) }; let f = fn(r) { match (r) { Result.Ok([v]) => v, Ok(w) => w } };", []string{}},
+		{"fn even(n) { odd(n) } fn odd(n) { even(n) }", []string{}},
+		{"let f = fn() { fn g() { h } g() }; g;", []string{"identifier not found: g", "identifier not found: h"}},
+		{"let f = x => x + y;", []string{"identifier not found: y"}},
+		{"let a = 1; a ? b : c?.d ?? e;", []string{"identifier not found: b", "identifier not found: c", "identifier not found: e"}},
+		{"match (x) { [a] if b => a }", []string{"identifier not found: x", "identifier not found: b"}},
+		{"enum Result { Ok(value) }; let f = fn(r) { match (r) { Reslt.Ok(v) => v } };", []string{"identifier not found: Reslt"}},
+		{"let f = fn(x) { match (x) { [a, ...rest] => rest, {name: n} if n => n, _ => a } };", []string{"identifier not found: a"}},
+	}
+
+	for _, tt := range tests {
+		l_resolver := resolve(l_test, tt.input)
+		errors := l_resolver.Errors()
+
+		if len(errors) != len(tt.expected) {
+			l_test.Errorf("wrong number of errors for %q, expected=%v, got=%v", tt.input, tt.expected, errors)
+			continue
+		}
+		for i, message := range tt.expected {
+			if errors[i] != message {
+				l_test.Errorf("wrong error message, expected=%q, got=%q", message, errors[i])
+			}
+		}
+	}
+}
+
+func TestShadowingWarnings(l_test *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let i = 5; let print_num = fn(i) { puts(i); };", []string{"declaration of i shadows an outer binding"}},
+		{"let f = fn(x) { let y = x; fn(y) { y } };", []string{"declaration of y shadows an outer binding"}},
+		{"let x = 1; let x = 2;", []string{}},
+		{"let f = fn(x) { let x = x + 1; x };", []string{}},
+	}
+
+	for _, tt := range tests {
+		warnings := resolve(l_test, tt.input).Warnings()
+
+		if len(warnings) != len(tt.expected) {
+			l_test.Errorf("wrong number of warnings for %q, expected=%v, got=%v", tt.input, tt.expected, warnings)
+			continue
+		}
+		for i, message := range tt.expected {
+			if warnings[i] != message {
+				l_test.Errorf("wrong warning message, expected=%q, got=%q", message, warnings[i])
+			}
+		}
+	}
+}
+
+func TestIdentifierAnnotations(l_test *testing.T) {
+	input := `
+   let g = 1;
+   let outer = fn(a, b) {
+     let c = a;
+     fn(d) { d + c + b + g };
+   };
+  `
+	program := parse(l_test, input)
+	l_resolver := New(no_builtins)
+	l_resolver.Resolve(program)
+	if len(l_resolver.Errors()) != 0 {
+		l_test.Fatalf("resolver has errors: %v", l_resolver.Errors())
+	}
+
+	outer := program.Statements[1].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	inner := outer.Body.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	sum := inner.Body.Statements[0].(*ast.ExpressionStatement).Expression
+
+	// ((d + c) + b) + g
+	tests := []struct {
+		name  string
+		depth int
+		slot  int
+	}{
+		{"g", 2, -1},
+		{"b", 1, 1},
+		{"c", 1, 2},
+		{"d", 0, 0},
+	}
+
+	for _, tt := range tests {
+		infix, ok := sum.(*ast.InfixExpression)
+		var ident *ast.Identifier
+		if ok {
+			ident = infix.Right.(*ast.Identifier)
+			sum = infix.Left
+		} else {
+			ident = sum.(*ast.Identifier)
+		}
+
+		if ident.Value != tt.name {
+			l_test.Fatalf("expected identifier %s, got=%s", tt.name, ident.Value)
+		}
+		if !ident.Resolved || ident.Depth != tt.depth || ident.Slot != tt.slot {
+			l_test.Errorf("%s resolved to (resolved=%t, depth=%d, slot=%d), want (depth=%d, slot=%d)",
+				tt.name, ident.Resolved, ident.Depth, ident.Slot, tt.depth, tt.slot)
+		}
+	}
+}
+
+func TestGlobalsPersistBetweenPrograms(l_test *testing.T) {
+	l_resolver := New(no_builtins)
+
+	l_resolver.Resolve(parse(l_test, "let x = 5;"))
+	l_resolver.Resolve(parse(l_test, "x;"))
+
+	if len(l_resolver.Errors()) != 0 {
+		l_test.Errorf("expected no errors, got=%v", l_resolver.Errors())
+	}
+
+	// The globals of a program that failed to resolve are not kept.
+	l_resolver.Resolve(parse(l_test, "let y = 1; missing;"))
+	l_resolver.Resolve(parse(l_test, "x; y;"))
+	if errors := l_resolver.Errors(); len(errors) != 1 || errors[0] != "identifier not found: y" {
+		l_test.Errorf("expected y to be undeclared, got=%v", errors)
+	}
+}
+
+// Helpers
+func parse(l_test *testing.T, input string) *ast.Program {
+	l_parser := parser.New(lexer.New(input))
+	program := l_parser.ParseProgram()
+	if len(l_parser.Errors()) != 0 {
+		l_test.Fatalf("parser has errors: %v", l_parser.Errors())
+	}
+	return program
+}
+
+func no_builtins(name string) bool {
+	return false
+}
+
+func resolve(l_test *testing.T, input string) *Resolver {
+	l_resolver := New(func(name string) bool { return name == "len" || name == "puts" })
+	l_resolver.Resolve(parse(l_test, input))
+	return l_resolver
+}